@@ -1,15 +1,227 @@
 package parprog
 
-import "sync"
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
 // BoundedExec provides a way to limit the number of concurrent goroutines (for
 // example when doing parallel reads when I/O contention is more of an issue
 // than CPU contention).
 //
 // At most n nameFunc()s will be called in parallel on every member of names.
+// No more goroutines than there are names are started, and n <= 0 is treated
+// as 1 (i.e. names are processed sequentially). The same applies to all of the
+// BoundedExec variants.
+//
+// If a nameFunc panics, the panic is recovered so that the remaining names are
+// still processed, and passed to OnPanic as a *PanicError. If OnPanic is not
+// set, BoundedExec instead panics again in the calling goroutine once all
+// names have finished, with a *PanicError describing the first panic, where it
+// can be handled by a deferred Viz cleanup or recover().
 func BoundedExec(n int, names []string, nameFunc func(string)) {
+	BoundedExecT(n, names, nameFunc)
+}
+
+// Run is a convenience for the common pattern of processing names with
+// BoundedExec while displaying each in v. At most n fn()s are called in
+// parallel, each under a reader named by the base name of its path, which is
+// completed with the error fn returns. A panic in fn is handled as in
+// BoundedExec; its reader is completed with the *PanicError.
+func (v *Viz) Run(n int, names []string, fn func(name string) error) {
+	BoundedExec(n, names, func(name string) {
+		h := v.AddReader(filepath.Base(name), nil)
+		v.completeAfter(h, name, func() error { return fn(name) })
+	})
+}
+
+// completeAfter calls fn and completes h with the error it returns. If fn
+// panics, h is completed with a *PanicError, which is then re-raised for the
+// caller's worker to recover.
+func (v *Viz) completeAfter(h *ReaderHandle, name string, fn func() error) {
+	var err error
+	defer func() {
+		if r := recover(); r != nil {
+			pe := newPanicError(name, r)
+			v.CompleteHandle(h, pe)
+			panic(pe)
+		}
+		v.CompleteHandle(h, err)
+	}()
+	err = fn()
+}
+
+// OnPanic, if set, is called with each panic recovered from a bounded task
+// (run by BoundedExec and its variants, Viz.Run, WalkBounded or a
+// BoundedPool), instead of the first being re-raised once the tasks have
+// finished. It is called from the goroutine which ran the task, so must be
+// safe for concurrent use. It should be set before any tasks are started.
+var OnPanic func(*PanicError)
+
+// panicTracker keeps the first panic recovered from a set of bounded tasks,
+// unless OnPanic is set to handle them instead.
+type panicTracker struct {
+	once  sync.Once
+	first *PanicError
+}
+
+func (t *panicTracker) recovered(pe *PanicError) {
+	if OnPanic != nil {
+		OnPanic(pe)
+		return
+	}
+	t.once.Do(func() { t.first = pe })
+}
+
+// raise re-raises the first panic recovered, if any.
+func (t *panicTracker) raise() {
+	if t.first != nil {
+		panic(t.first)
+	}
+}
+
+// PanicError describes a panic recovered from a bounded task.
+type PanicError struct {
+	Name  string      // name of the task which panicked
+	Value interface{} // value passed to panic()
+	Stack []byte      // stack trace of the panicking goroutine
+}
+
+func newPanicError(name string, value interface{}) *PanicError {
+	if pe, ok := value.(*PanicError); ok {
+		return pe
+	}
+	return &PanicError{Name: name, Value: value, Stack: debug.Stack()}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%s: panic: %v\n\n%s", e.Name, e.Value, e.Stack)
+}
+
+// BoundedExecT is a generic version of BoundedExec, calling at most n fn()s in
+// parallel on every member of items.
+func BoundedExecT[T any](n int, items []T, fn func(T)) {
+	n = workerCount(n, len(items))
+	boundedChan := make(chan T, n)
+	go func() {
+		for _, item := range items {
+			boundedChan <- item
+		}
+		close(boundedChan)
+	}()
+
+	boundedRun(n, boundedChan, fn, itemName[T])
+}
+
+// BoundedExecRate is like BoundedExec, but also starts at most rate nameFunc()
+// calls per second, even when workers are free. A rate <= 0 is unlimited.
+func BoundedExecRate(n int, rate float64, names []string, nameFunc func(string)) {
+	if rate <= 0 {
+		BoundedExec(n, names, nameFunc)
+		return
+	}
+	n = workerCount(n, len(names))
+	// unbuffered, so that each name is only handed over once its slot is due
+	boundedChan := make(chan string)
+	go func() {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+		defer ticker.Stop()
+		for i, name := range names {
+			if i > 0 {
+				<-ticker.C
+			}
+			boundedChan <- name
+		}
+		close(boundedChan)
+	}()
+
+	boundedRun(n, boundedChan, nameFunc, itemName[string])
+}
+
+// FileTask is a unit of work for BoundedBytes, such as a file to be read.
+type FileTask struct {
+	Name string
+	Size int64 // bytes counted against the budget while the task runs
+}
+
+// BoundedBytes is like BoundedExec, but limits concurrency by the total size
+// of the tasks in flight rather than their number. Tasks are started in order,
+// each only once its size plus the sizes of those already running is at most
+// maxBytes. A task is always started when nothing else is running, so a file
+// larger than maxBytes runs on its own.
+func BoundedBytes(maxBytes int64, files []FileTask, fn func(FileTask)) {
+	var mu sync.Mutex
+	released := sync.NewCond(&mu)
+	var inFlight int64
+	running := 0
+
 	wg := sync.WaitGroup{}
-	boundedChan := make(chan string, n)
+	var panics panicTracker
+
+	for _, f := range files {
+		size := f.Size
+		if size < 0 {
+			size = 0
+		}
+		mu.Lock()
+		for running > 0 && inFlight+size > maxBytes {
+			released.Wait()
+		}
+		inFlight += size
+		running++
+		mu.Unlock()
+
+		wg.Add(1)
+		go func(f FileTask) {
+			defer func() {
+				if r := recover(); r != nil {
+					panics.recovered(newPanicError(f.Name, r))
+				}
+				mu.Lock()
+				inFlight -= size
+				running--
+				mu.Unlock()
+				released.Signal()
+				wg.Done()
+			}()
+			fn(f)
+		}(f)
+	}
+
+	wg.Wait()
+	panics.raise()
+}
+
+// BoundedExecChan is like BoundedExec, but consumes names from a channel until
+// it is closed, so that names can be produced lazily (e.g. from filepath.Walk).
+func BoundedExecChan(n int, names <-chan string, fn func(string)) {
+	if n < 1 {
+		n = 1
+	}
+	boundedRun(n, names, fn, itemName[string])
+}
+
+// boundedRun starts n workers calling fn on items received from ch, and
+// returns when ch is closed and all workers have finished. Panics in fn are
+// recovered, and passed to OnPanic or the first re-raised once all workers
+// have finished.
+func boundedRun[T any](n int, ch <-chan T, fn func(T), name func(T) string) {
+	wg := sync.WaitGroup{}
+	var panics panicTracker
+
+	call := func(item T) {
+		defer func() {
+			if r := recover(); r != nil {
+				panics.recovered(newPanicError(name(item), r))
+			}
+		}()
+		fn(item)
+	}
 
 	for i := 0; i < n; i++ {
 		wg.Add(1)
@@ -17,19 +229,172 @@ func BoundedExec(n int, names []string, nameFunc func(string)) {
 		go func() {
 			defer wg.Done()
 			for {
-				name, ok := <-boundedChan
+				item, ok := <-ch
 				if !ok {
 					return
 				}
-				nameFunc(name)
+				call(item)
 			}
 		}()
 	}
 
-	for _, fn := range names {
-		boundedChan <- fn
+	wg.Wait()
+	panics.raise()
+}
+
+func itemName[T any](item T) string {
+	return fmt.Sprint(item)
+}
+
+// BoundedExecContext is like BoundedExec, but stops dispatching names once ctx
+// is cancelled. The context is passed to each nameFunc call so that in-flight
+// work can also observe cancellation. It returns the number of names that were
+// actually started.
+func BoundedExecContext(ctx context.Context, n int, names []string, nameFunc func(context.Context, string)) int {
+	n = workerCount(n, len(names))
+	boundedChan := make(chan string, n)
+	var started int64
+
+	go func() {
+	dispatch:
+		for _, fn := range names {
+			select {
+			case <-ctx.Done():
+				break dispatch
+			case boundedChan <- fn:
+			}
+		}
+		close(boundedChan)
+	}()
+
+	boundedRun(n, boundedChan, func(name string) {
+		if ctx.Err() != nil {
+			// drain anything buffered before the cancellation
+			return
+		}
+		atomic.AddInt64(&started, 1)
+		nameFunc(ctx, name)
+	}, itemName[string])
+
+	return int(started)
+}
+
+// BoundedExecErr is like BoundedExec, but collects the error returned by each
+// fn call. The returned slice is aligned with names, so errs[i] is the result
+// of fn(names[i]). A panicking fn is reported as a *PanicError in its slot
+// instead of being re-raised.
+func BoundedExecErr(n int, names []string, fn func(string) error) []error {
+	return BoundedMap(n, names, func(name string) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = newPanicError(name, r)
+			}
+		}()
+		return fn(name)
+	})
+}
+
+// BoundedExecFailFast is like BoundedExecErr, but stops dispatching names as
+// soon as any fn call returns an error. Once the calls already in flight have
+// finished, the first error is returned, or nil if every call succeeded.
+func BoundedExecFailFast(n int, names []string, fn func(string) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var errOnce sync.Once
+	var firstErr error
+	BoundedExecContext(ctx, n, names, func(ctx context.Context, name string) {
+		if err := fn(name); err != nil {
+			errOnce.Do(func() { firstErr = err })
+			cancel()
+		}
+	})
+	return firstErr
+}
+
+// BoundedMap calls at most n fn()s in parallel on every member of items, and
+// returns the results in the same order as items.
+func BoundedMap[T, R any](n int, items []T, fn func(T) R) []R {
+	n = workerCount(n, len(items))
+	boundedChan := make(chan int, n)
+	results := make([]R, len(items))
+
+	go func() {
+		for i := range items {
+			boundedChan <- i
+		}
+		close(boundedChan)
+	}()
+
+	boundedRun(n, boundedChan, func(idx int) {
+		// each index is only written by one goroutine
+		results[idx] = fn(items[idx])
+	}, func(idx int) string {
+		return itemName(items[idx])
+	})
+
+	return results
+}
+
+// BoundedExecTimeout is like BoundedExecContext, but gives each fn call a
+// context with the given timeout. It returns the names which exceeded their
+// timeout, in the same order as names.
+//
+// NB when a call times out its worker moves on to the next name immediately,
+// but the goroutine running fn cannot be killed and keeps running until fn
+// returns. fn should therefore watch ctx.Done() and bail out promptly. Panics
+// occurring after a timeout are discarded.
+func BoundedExecTimeout(n int, names []string, timeout time.Duration, fn func(context.Context, string)) []string {
+	timedOut := BoundedMap(n, names, func(name string) bool {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		var pe *PanicError
+		done := make(chan struct{})
+		go func() {
+			defer func() {
+				if r := recover(); r != nil {
+					pe = newPanicError(name, r)
+				}
+				close(done)
+			}()
+			fn(ctx, name)
+		}()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			select {
+			case <-done:
+				// finished right at the deadline
+			default:
+				return true
+			}
+		}
+		if pe != nil {
+			panic(pe)
+		}
+		return false
+	})
+
+	var res []string
+	for i, t := range timedOut {
+		if t {
+			res = append(res, names[i])
+		}
 	}
-	close(boundedChan)
+	return res
+}
 
-	wg.Wait()
+// workerCount returns the number of workers needed to run at most n tasks in
+// parallel from a list of size tasks, so idle workers are never started. At
+// least one worker is always used so that n <= 0 cannot deadlock.
+func workerCount(n, size int) int {
+	if n < 1 {
+		n = 1
+	}
+	if n > size {
+		return size
+	}
+	return n
 }
@@ -0,0 +1,453 @@
+package parprog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// manyNames returns n distinct names.
+func manyNames(n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprint("name", i)
+	}
+	return names
+}
+
+func TestBoundedExecContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls, sawCancel int64
+	started := BoundedExecContext(ctx, 2, manyNames(100), func(ctx context.Context, name string) {
+		if atomic.AddInt64(&calls, 1) == 5 {
+			cancel()
+		}
+		if ctx.Err() != nil {
+			atomic.AddInt64(&sawCancel, 1)
+		}
+	})
+	if started != int(calls) {
+		t.Errorf("returned %d started, but %d calls were made", started, calls)
+	}
+	if started < 5 || started == 100 {
+		t.Errorf("started %d names, want dispatching to stop soon after 5", started)
+	}
+	if sawCancel == 0 {
+		t.Error("no call observed the cancellation")
+	}
+}
+
+func TestBoundedExecErr(t *testing.T) {
+	names := manyNames(20)
+	errs := BoundedExecErr(4, names, func(name string) error {
+		switch name {
+		case "name3", "name17":
+			return errors.New(name + " failed")
+		case "name8":
+			panic("boom")
+		}
+		return nil
+	})
+	if len(errs) != len(names) {
+		t.Fatalf("got %d errors for %d names", len(errs), len(names))
+	}
+	for i, err := range errs {
+		switch names[i] {
+		case "name3", "name17":
+			if err == nil || err.Error() != names[i]+" failed" {
+				t.Errorf("errs[%d] = %v", i, err)
+			}
+		case "name8":
+			if pe, ok := err.(*PanicError); !ok || pe.Name != "name8" || pe.Value != "boom" {
+				t.Errorf("errs[%d] = %v, want a *PanicError", i, err)
+			}
+		default:
+			if err != nil {
+				t.Errorf("errs[%d] = %v, want nil", i, err)
+			}
+		}
+	}
+}
+
+// gauge tracks the most calls in progress at once.
+type gauge struct {
+	cur, max int64
+}
+
+func (g *gauge) enter() {
+	g.add(1)
+}
+
+// add adds n to the current value, recording the maximum seen.
+func (g *gauge) add(n int64) {
+	n = atomic.AddInt64(&g.cur, n)
+	for {
+		m := atomic.LoadInt64(&g.max)
+		if n <= m || atomic.CompareAndSwapInt64(&g.max, m, n) {
+			return
+		}
+	}
+}
+
+func (g *gauge) leave() {
+	atomic.AddInt64(&g.cur, -1)
+}
+
+func TestBoundedExecT(t *testing.T) {
+	type item struct{ id int }
+	items := make([]item, 50)
+	for i := range items {
+		items[i].id = i + 1
+	}
+
+	var g gauge
+	var sum int64
+	BoundedExecT(3, items, func(it item) {
+		g.enter()
+		defer g.leave()
+		time.Sleep(time.Millisecond)
+		atomic.AddInt64(&sum, int64(it.id))
+	})
+	if sum != 50*51/2 {
+		t.Errorf("sum of ids = %d, want every item processed once", sum)
+	}
+	if g.max > 3 || g.max < 2 {
+		t.Errorf("%d calls ran at once, want at most 3", g.max)
+	}
+}
+
+func TestBoundedMap(t *testing.T) {
+	items := make([]int, 40)
+	for i := range items {
+		items[i] = i
+	}
+	var g gauge
+	res := BoundedMap(4, items, func(i int) string {
+		g.enter()
+		defer g.leave()
+		// finish out of order
+		time.Sleep(time.Duration(len(items)-i) * 50 * time.Microsecond)
+		return fmt.Sprint(i * i)
+	})
+	for i, r := range res {
+		if r != fmt.Sprint(i*i) {
+			t.Fatalf("res[%d] = %q, want %d", i, r, i*i)
+		}
+	}
+	if g.max > 4 {
+		t.Errorf("%d calls ran at once, want at most 4", g.max)
+	}
+}
+
+func TestBoundedExecBound(t *testing.T) {
+	tests := []struct {
+		n, names, want int
+	}{
+		{4, 5000, 4},
+		{10, 3, 3}, // more workers than names
+		{0, 100, 1},
+		{-2, 100, 1},
+	}
+	for _, tt := range tests {
+		var g gauge
+		var calls int64
+		BoundedExec(tt.n, manyNames(tt.names), func(string) {
+			g.enter()
+			atomic.AddInt64(&calls, 1)
+			g.leave()
+		})
+		if calls != int64(tt.names) {
+			t.Errorf("n=%d: %d of %d names processed", tt.n, calls, tt.names)
+		}
+		if g.max > int64(tt.want) {
+			t.Errorf("n=%d: %d calls ran at once, want at most %d", tt.n, g.max, tt.want)
+		}
+	}
+}
+
+func TestBoundedBytes(t *testing.T) {
+	tests := []struct {
+		max   int64
+		sizes []int64
+		want  int64 // most bytes in flight at once
+	}{
+		{100, []int64{40, 40, 40, 30, 60, 10, 90, 20, 50, 50}, 100},
+		{10, []int64{50, 5, 50, 5}, 50}, // oversize tasks run alone
+		{0, []int64{1, 2, 3}, 3},
+	}
+	for _, tt := range tests {
+		var files []FileTask
+		for i, size := range tt.sizes {
+			files = append(files, FileTask{Name: fmt.Sprint(i), Size: size})
+		}
+		var g gauge
+		var calls int64
+		BoundedBytes(tt.max, files, func(f FileTask) {
+			g.add(f.Size)
+			atomic.AddInt64(&calls, 1)
+			time.Sleep(time.Millisecond)
+			g.add(-f.Size)
+		})
+		if calls != int64(len(files)) {
+			t.Errorf("max=%d: %d of %d tasks processed", tt.max, calls, len(files))
+		}
+		if g.max > tt.want {
+			t.Errorf("max=%d: %d bytes in flight at once, want at most %d", tt.max, g.max, tt.want)
+		}
+	}
+}
+
+func TestBoundedExecZero(t *testing.T) {
+	for _, n := range []int{0, -1} {
+		var seen []string
+		within(t, time.Second, fmt.Sprintf("BoundedExec(%d)", n), func() {
+			BoundedExec(n, []string{"a", "b", "c"}, func(name string) {
+				// sequential, so no locking is needed
+				seen = append(seen, name)
+			})
+		})
+		if len(seen) != 3 {
+			t.Errorf("BoundedExec(%d) processed %q", n, seen)
+		}
+	}
+	within(t, time.Second, "BoundedExec with no names", func() {
+		BoundedExec(0, nil, func(string) { t.Error("called with no names") })
+	})
+}
+
+func TestBoundedExecTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	var quick int64
+	var timedOut []string
+	within(t, 2*time.Second, "BoundedExecTimeout", func() {
+		timedOut = BoundedExecTimeout(1, []string{"a", "hung", "b", "c"}, 20*time.Millisecond, func(ctx context.Context, name string) {
+			if name == "hung" {
+				// ignores ctx, like a read from a bad NFS mount
+				<-release
+				return
+			}
+			atomic.AddInt64(&quick, 1)
+		})
+	})
+	if len(timedOut) != 1 || timedOut[0] != "hung" {
+		t.Errorf("timed out = %q, want [hung]", timedOut)
+	}
+	if quick != 3 {
+		t.Errorf("%d quick names ran, want the worker freed to run all 3", quick)
+	}
+}
+
+func TestBoundedExecChan(t *testing.T) {
+	names := make(chan string)
+	go func() {
+		for i := 0; i < 50; i++ {
+			names <- fmt.Sprint("name", i)
+		}
+		close(names)
+	}()
+
+	var g gauge
+	var calls int64
+	BoundedExecChan(3, names, func(string) {
+		g.enter()
+		defer g.leave()
+		atomic.AddInt64(&calls, 1)
+	})
+	if calls != 50 {
+		t.Errorf("%d of 50 names processed", calls)
+	}
+	if g.max > 3 {
+		t.Errorf("%d calls ran at once, want at most 3", g.max)
+	}
+}
+
+func TestBoundedExecPanic(t *testing.T) {
+	v := &Viz{}
+	v.StartWriter(io.Discard, time.Hour)
+
+	var calls int64
+	var recovered interface{}
+	func() {
+		defer func() { recovered = recover() }()
+		defer v.Recover()
+		BoundedExec(2, manyNames(10), func(name string) {
+			if name == "name3" {
+				panic("boom")
+			}
+			atomic.AddInt64(&calls, 1)
+		})
+	}()
+
+	if calls != 9 {
+		t.Errorf("%d of the other 9 names ran", calls)
+	}
+	pe, ok := recovered.(*PanicError)
+	if !ok || pe.Name != "name3" || pe.Value != "boom" || len(pe.Stack) == 0 {
+		t.Fatalf("recovered %#v, want a *PanicError for name3", recovered)
+	}
+	select {
+	case <-v.done:
+	default:
+		t.Error("Recover did not stop the display")
+	}
+}
+
+func TestOnPanic(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	OnPanic = func(pe *PanicError) {
+		mu.Lock()
+		got = append(got, fmt.Sprintf("%s %v", pe.Name, pe.Value))
+		mu.Unlock()
+	}
+	defer func() { OnPanic = nil }()
+
+	var calls int64
+	BoundedExec(2, manyNames(10), func(name string) {
+		if name == "name3" || name == "name7" {
+			panic("boom")
+		}
+		atomic.AddInt64(&calls, 1)
+	})
+	BoundedBytes(10, []FileTask{{"big", 5}, {"small", 1}}, func(f FileTask) {
+		if f.Name == "big" {
+			panic("too big")
+		}
+	})
+	v := &Viz{}
+	v.Run(2, []string{"dir/bad"}, func(string) error { panic("bad") })
+	p := NewBoundedPool(2)
+	p.Submit("task", func(string) { panic("pool") })
+	p.Wait()
+
+	if calls != 8 {
+		t.Errorf("%d of the other 8 names ran", calls)
+	}
+	sort.Strings(got)
+	want := []string{"big too big", "dir/bad bad", "name3 boom", "name7 boom", "task pool"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("OnPanic got %q, want %q", got, want)
+	}
+	if err, _ := v.Error("bad"); err == nil {
+		t.Error("the panicking reader was not completed with its error")
+	}
+}
+
+func TestRun(t *testing.T) {
+	v := &Viz{}
+	errBad := errors.New("bad")
+	names := []string{"a/one.txt", "b/two.txt", "c/bad.txt"}
+	v.Run(2, names, func(name string) error {
+		if name == "c/bad.txt" {
+			return errBad
+		}
+		return nil
+	})
+
+	st := v.Snapshot()
+	if len(st) != len(names) {
+		t.Fatalf("%d readers, want %d", len(st), len(names))
+	}
+	want := map[string]error{"one.txt": nil, "two.txt": nil, "bad.txt": errBad}
+	for _, s := range st {
+		err, ok := want[s.Name]
+		if !ok || !s.Done || s.Err != err {
+			t.Errorf("%s done=%v err=%v, want done with %v", s.Name, s.Done, s.Err, err)
+		}
+		delete(want, s.Name)
+	}
+}
+
+func TestRunPanic(t *testing.T) {
+	v := &Viz{}
+	var recovered interface{}
+	func() {
+		defer func() { recovered = recover() }()
+		v.Run(2, manyNames(4), func(name string) error {
+			if name == "name1" {
+				panic("boom")
+			}
+			return nil
+		})
+	}()
+	if pe, ok := recovered.(*PanicError); !ok || pe.Name != "name1" {
+		t.Fatalf("recovered %#v, want a *PanicError for name1", recovered)
+	}
+	if err, _ := v.Error("name1"); err != recovered {
+		t.Errorf("name1 completed with %v", err)
+	}
+}
+
+func TestBoundedExecRate(t *testing.T) {
+	const rate = 100 // so one start every 10ms
+	var mu sync.Mutex
+	var starts []time.Time
+	var g gauge
+	BoundedExecRate(2, rate, manyNames(10), func(name string) {
+		g.enter()
+		defer g.leave()
+		mu.Lock()
+		starts = append(starts, time.Now())
+		mu.Unlock()
+		time.Sleep(15 * time.Millisecond)
+	})
+
+	if len(starts) != 10 {
+		t.Fatalf("%d of 10 names started", len(starts))
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+	// allow for a tick delivered late, then promptly followed by the next
+	for i := 2; i < len(starts); i++ {
+		if d := starts[i].Sub(starts[i-2]); d < 15*time.Millisecond {
+			t.Errorf("starts %d and %d only %v apart", i-2, i, d)
+		}
+	}
+	if span := starts[9].Sub(starts[0]); span < 80*time.Millisecond {
+		t.Errorf("10 starts within %v, want about 90ms at %d per second", span, rate)
+	}
+	if g.max > 2 {
+		t.Errorf("%d ran at once, want at most 2", g.max)
+	}
+}
+
+func TestBoundedExecFailFast(t *testing.T) {
+	var mu sync.Mutex
+	started := map[string]bool{}
+	errBad := errors.New("name1 failed")
+	err := BoundedExecFailFast(2, manyNames(20), func(name string) error {
+		mu.Lock()
+		started[name] = true
+		mu.Unlock()
+		if name == "name1" {
+			return errBad
+		}
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	})
+	if err != errBad {
+		t.Errorf("returned %v, want %v", err, errBad)
+	}
+	if len(started) > 4 {
+		t.Errorf("%d names started after the first error", len(started))
+	}
+	for _, name := range manyNames(20)[4:] {
+		if started[name] {
+			t.Errorf("%s started after name1 failed", name)
+		}
+	}
+
+	if err := BoundedExecFailFast(2, manyNames(5), func(string) error { return nil }); err != nil {
+		t.Errorf("returned %v when every call succeeded", err)
+	}
+}
@@ -0,0 +1,155 @@
+package parprog
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ColumnKind selects what a Column shows.
+type ColumnKind int
+
+const (
+	// ColumnName shows the reader's name, indented for children of a group.
+	ColumnName ColumnKind = iota
+	// ColumnStatus shows the reader's full status, as in the default layout.
+	ColumnStatus
+	// ColumnPercent shows the percent complete.
+	ColumnPercent
+	// ColumnBar shows a progress bar.
+	ColumnBar
+	// ColumnRate shows the byte rate of readers which count bytes.
+	ColumnRate
+	// ColumnETA shows the estimated time remaining of readers with a size.
+	ColumnETA
+	// ColumnError shows the error the reader was completed with.
+	ColumnError
+)
+
+// Column describes one column of a reader's row. A Width of 0 uses a default
+// width for the kind, or for names and errors, their natural width (subject
+// to NameWidth and ErrorWrap respectively). Bars are at least 5 wide.
+type Column struct {
+	Kind  ColumnKind
+	Width int
+}
+
+// defaultColumnWidths are the widths used for a Column with a Width of 0.
+var defaultColumnWidths = map[ColumnKind]int{
+	ColumnStatus:  15,
+	ColumnPercent: 7,
+	ColumnBar:     20,
+	ColumnRate:    10,
+	ColumnETA:     7,
+}
+
+// Columns replaces the layout of each reader's row, which by default is a
+// status column, then the name (with a progress bar if ShowBars is set), then
+// any error. Columns are separated by a space. With no columns the default
+// layout is restored. It should be called before Start.
+func (v *Viz) Columns(cols ...Column) {
+	v.columns = cols
+}
+
+// drawColumns draws r on row y of f according to the configured columns, and
+// returns the row following it. An error in the last column may wrap onto the
+// following rows, up to maxY.
+func (v *Viz) drawColumns(f *frame, y, maxY int, r readInfo, status string, cs *ColorScheme) int {
+	tag, nameColor := v.tagStyle(r, cs)
+	statusColor := cs.Status
+	if r.Error != nil && !r.Cancelled {
+		statusColor, nameColor = cs.Error, cs.Error
+	}
+
+	x := 0
+	next := y + 1
+	for i, c := range v.columns {
+		if i > 0 {
+			x = f.drawString(x, y, " ", statusColor)
+		}
+		width := c.Width
+		if width <= 0 {
+			width = defaultColumnWidths[c.Kind]
+		}
+
+		switch c.Kind {
+		case ColumnName:
+			if tag != "" {
+				x = f.drawString(x, y, tag, v.tags[r.Tag].Color)
+				width -= utf8.RuneCountInString(tag)
+			}
+			name := r.label()
+			if r.Parent != nil {
+				name = "  " + name
+			}
+			if c.Width > 0 {
+				name = padRight(truncateMiddle(name, width), width)
+			} else {
+				name = v.fitName(name)
+			}
+			x = f.drawString(x, y, name, nameColor)
+
+		case ColumnBar:
+			if width < minBarWidth {
+				// too narrow to show anything between the brackets
+				width = minBarWidth
+			}
+			bar := strings.Repeat(" ", width)
+			if r.Done || percentOf(r) > 0 {
+				bar = progressBar(percentOf(r), width)
+			}
+			x = f.drawString(x, y, bar, nameColor)
+
+		case ColumnError:
+			es := ""
+			if r.Error != nil {
+				es = r.Error.Error()
+			}
+			if c.Width > 0 {
+				x = f.drawString(x, y, padRight(truncateMiddle(es, width), width), cs.Error)
+			} else if i == len(v.columns)-1 {
+				next = v.drawError(f, x, y, maxY, es, cs.Error)
+			} else {
+				x = f.drawString(x, y, es, cs.Error)
+			}
+
+		default:
+			x = f.drawString(x, y, fmt.Sprintf("%*s", width, columnText(c.Kind, r, status)), statusColor)
+		}
+	}
+	return next
+}
+
+// columnText returns the text of the right-aligned column kinds for r.
+func columnText(kind ColumnKind, r readInfo, status string) string {
+	if kind == ColumnStatus {
+		return status
+	}
+	if kind == ColumnPercent {
+		return fmt.Sprintf("%.2f%%", percentOf(r))
+	}
+
+	ss, ok := r.View.(sizedStatus)
+	if !ok || r.Done {
+		return ""
+	}
+	p := ss.progress()
+	switch kind {
+	case ColumnRate:
+		return formatBytes(p.rate) + "/s"
+	case ColumnETA:
+		if p.eta.IsZero() {
+			return "--"
+		}
+		return formatDuration(p.eta.Sub(p.lastTime))
+	}
+	return ""
+}
+
+// padRight pads s with spaces to width runes.
+func padRight(s string, width int) string {
+	if n := width - utf8.RuneCountInString(s); n > 0 {
+		return s + strings.Repeat(" ", n)
+	}
+	return s
+}
@@ -0,0 +1,71 @@
+package parprog
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestColumns(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	v.Add("half", nil)
+	v.SetProgress("half", 0.5)
+	v.Add("a-rather-long-name", nil)
+	v.Complete("a-rather-long-name", errors.New("failed"))
+	def := draw(v, 60, 4).String()
+
+	v.Columns(Column{Kind: ColumnName, Width: 10}, Column{Kind: ColumnBar, Width: 12},
+		Column{Kind: ColumnPercent}, Column{Kind: ColumnError})
+	want := []string{
+		"a-ra…-name [##########] 100.00% failed",
+		"half       [#####-----]  50.00%",
+	}
+	m := draw(v, 60, 4)
+	for i, w := range want {
+		if got := row(m, i+1); got != w {
+			t.Errorf("row %d = %q, want %q", i+1, got, w)
+		}
+	}
+
+	// bars too narrow to draw are widened
+	v.Columns(Column{Kind: ColumnBar, Width: 1}, Column{Kind: ColumnName})
+	want = []string{
+		"[###] a-rather-long-name",
+		"[#--] half",
+	}
+	m = draw(v, 60, 4)
+	for i, w := range want {
+		if got := row(m, i+1); got != w {
+			t.Errorf("row %d = %q, want %q", i+1, got, w)
+		}
+	}
+
+	// no columns restores the default layout
+	v.Columns()
+	if got := draw(v, 60, 4).String(); got != def {
+		t.Errorf("default layout = %q, want %q", got, def)
+	}
+}
+
+func TestColumnsRate(t *testing.T) {
+	clk := newFakeClock()
+	v := newTestViz(clk)
+	v.Columns(Column{Kind: ColumnName}, Column{Kind: ColumnRate}, Column{Kind: ColumnETA})
+	r := v.AddSized("data", strings.NewReader(strings.Repeat("x", 10<<10)), 10<<10)
+	v.Add("spinner", nil)
+	draw(v, 60, 4)
+	clk.advance(time.Second)
+	io.CopyN(io.Discard, r, 1<<10)
+	draw(v, 60, 4)
+
+	m := draw(v, 60, 4)
+	// the rate is smoothed, so 9 KB remain at 307.2 B/s (shown rounded)
+	if got, want := row(m, 2), "data    307 B/s    0:30"; got != want {
+		t.Errorf("sized row = %q, want %q", got, want)
+	}
+	if got, want := row(m, 1), "spinner"; got != want {
+		t.Errorf("spinner row = %q, want %q", got, want)
+	}
+}
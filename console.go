@@ -0,0 +1,16 @@
+package parprog
+
+import "github.com/nsf/termbox-go"
+
+// consoleColor maps display attributes to ones the Windows console can show.
+// It is defined on every platform so the mapping can be checked without a
+// Windows terminal.
+//
+// The console has no underline outside of DBCS code pages, so it is replaced
+// with bold (i.e. a high-intensity foreground) to keep the emphasis.
+func consoleColor(a termbox.Attribute) termbox.Attribute {
+	if a&termbox.AttrUnderline != 0 {
+		a = a&^termbox.AttrUnderline | termbox.AttrBold
+	}
+	return a
+}
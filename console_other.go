@@ -0,0 +1,14 @@
+//go:build !windows
+
+package parprog
+
+import "github.com/nsf/termbox-go"
+
+// ellipsis marks where text has been shortened.
+const ellipsis = "…"
+
+// platformColor maps display attributes to ones the terminal can show, which
+// is all of them outside of Windows.
+func platformColor(a termbox.Attribute) termbox.Attribute {
+	return a
+}
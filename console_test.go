@@ -0,0 +1,25 @@
+package parprog
+
+import (
+	"testing"
+
+	"github.com/nsf/termbox-go"
+)
+
+func TestConsoleColor(t *testing.T) {
+	tests := []struct {
+		in, want termbox.Attribute
+	}{
+		{termbox.ColorDefault, termbox.ColorDefault},
+		{termbox.ColorRed, termbox.ColorRed},
+		{termbox.ColorGreen | termbox.AttrBold, termbox.ColorGreen | termbox.AttrBold},
+		{termbox.ColorYellow | termbox.AttrReverse, termbox.ColorYellow | termbox.AttrReverse},
+		{termbox.ColorCyan | termbox.AttrUnderline, termbox.ColorCyan | termbox.AttrBold},
+		{termbox.AttrUnderline | termbox.AttrBold, termbox.AttrBold},
+	}
+	for _, tt := range tests {
+		if got := consoleColor(tt.in); got != tt.want {
+			t.Errorf("consoleColor(%v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
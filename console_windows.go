@@ -0,0 +1,9 @@
+//go:build windows
+
+package parprog
+
+// ellipsis marks where text has been shortened. The legacy console fonts
+// have no "…".
+const ellipsis = "~"
+
+var platformColor = consoleColor
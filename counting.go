@@ -0,0 +1,167 @@
+package parprog
+
+import (
+	"io"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// byteCounter shows progress from a byte count updated by the reading (or
+// writing) goroutine. The display goroutine reads it concurrently, so it is
+// accessed atomically. If the total size is unknown (<= 0), a spinner is shown
+// along with the cumulative byte count.
+type byteCounter struct {
+	n int64
+	wheel
+	byteProgress
+}
+
+func (c *byteCounter) ReadStatus() string {
+	n := atomic.LoadInt64(&c.n)
+	if c.size > 0 {
+		if c.elapsed != 0 {
+			return c.finalStatus(c.elapsed)
+		}
+		return c.update(n)
+	}
+
+	if c.elapsed != 0 {
+		b := append(c.buf[:0], c.duration(c.elapsed)...)
+		b = append(b, ' ')
+		b = appendBytes(b, float64(n))
+		c.buf = b
+		return string(b)
+	}
+	c.sample(n)
+	b := append(c.buf[:0], c.duration(c.sinceStart())...)
+	b = append(b, ' ')
+	b = appendBytes(b, float64(n))
+	b = append(b, ' ')
+	b = appendBytes(b, c.rate)
+	b = append(b, "/s "...)
+	b = utf8.AppendRune(b, c.next())
+	c.buf = b
+	return string(b)
+}
+
+//////////
+
+// countingReader counts bytes as they are read so that progress can be shown
+// for readers which cannot be inspected directly.
+type countingReader struct {
+	r io.Reader
+	byteCounter
+}
+
+func newCountingReader(r io.Reader, total int64) *countingReader {
+	return &countingReader{
+		r:           r,
+		byteCounter: byteCounter{byteProgress: newByteProgress(total)},
+	}
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	atomic.AddInt64(&c.n, int64(n))
+	return n, err
+}
+
+// WriteTo is only exposed by wrap when the underlying reader is an io.WriterTo.
+func (c *countingReader) WriteTo(w io.Writer) (int64, error) {
+	return c.r.(io.WriterTo).WriteTo(countingWriter{w: w, n: &c.n})
+}
+
+// wrap returns an io.Reader for c which also implements io.Closer and
+// io.WriterTo if the underlying reader does.
+func (c *countingReader) wrap() io.Reader {
+	cl, isCloser := c.r.(io.Closer)
+	_, isWriterTo := c.r.(io.WriterTo)
+	switch {
+	case isCloser && isWriterTo:
+		return struct {
+			io.Reader
+			io.Closer
+			io.WriterTo
+		}{c, cl, c}
+	case isCloser:
+		return struct {
+			io.Reader
+			io.Closer
+		}{c, cl}
+	case isWriterTo:
+		return struct {
+			io.Reader
+			io.WriterTo
+		}{c, c}
+	}
+	return struct{ io.Reader }{c}
+}
+
+//////////
+
+// countingWriter atomically adds the number of bytes written to n.
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (cw countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	atomic.AddInt64(cw.n, int64(n))
+	return n, err
+}
+
+// wrap returns an io.Writer for cw which also implements io.Closer if the
+// underlying writer does.
+func (cw countingWriter) wrap() io.Writer {
+	if cl, ok := cw.w.(io.Closer); ok {
+		return struct {
+			io.Writer
+			io.Closer
+		}{cw, cl}
+	}
+	return cw
+}
+
+//////////
+
+// SectionReader is returned by Viz.AddSection. Like an *io.SectionReader it
+// supports both sequential and positioned reads.
+type SectionReader interface {
+	io.ReadSeeker
+	io.ReaderAt
+	Size() int64
+}
+
+// sectionReader counts progress through an io.SectionReader, following seeks
+// so that the count is always the offset within the section. Positioned reads
+// add the bytes read instead, as each usually covers a different part of the
+// section.
+type sectionReader struct {
+	sr *io.SectionReader
+	byteCounter
+}
+
+func (s *sectionReader) Read(p []byte) (int, error) {
+	n, err := s.sr.Read(p)
+	atomic.AddInt64(&s.n, int64(n))
+	return n, err
+}
+
+func (s *sectionReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := s.sr.Seek(offset, whence)
+	if err == nil {
+		atomic.StoreInt64(&s.n, pos)
+	}
+	return pos, err
+}
+
+func (s *sectionReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := s.sr.ReadAt(p, off)
+	atomic.AddInt64(&s.n, int64(n))
+	return n, err
+}
+
+func (s *sectionReader) Size() int64 {
+	return s.sr.Size()
+}
@@ -0,0 +1,214 @@
+package parprog
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// closeReader records whether it was closed.
+type closeReader struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeReader) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestAddSized(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	r := v.AddSized("a", bytes.NewReader(make([]byte, 1000)), 1000)
+
+	if _, err := io.ReadFull(r, make([]byte, 250)); err != nil {
+		t.Fatal(err)
+	}
+	if st := statusOf(v, "a"); !strings.Contains(st, " 25.00% ") {
+		t.Errorf("status = %q, want 25.00%%", st)
+	}
+	if pct := percent(v, "a"); pct != 25 {
+		t.Errorf("percent = %v, want 25", pct)
+	}
+
+	// the rest is copied with WriteTo, which is counted too
+	if _, ok := r.(io.WriterTo); !ok {
+		t.Fatal("wrapper hides the WriterTo of a bytes.Reader")
+	}
+	if n, err := io.Copy(io.Discard, r); n != 750 || err != nil {
+		t.Fatalf("copied %d, %v", n, err)
+	}
+	statusOf(v, "a")
+	if pct := percent(v, "a"); pct != 100 {
+		t.Errorf("percent after copying the rest = %v, want 100", pct)
+	}
+}
+
+func TestAddSizedInterfaces(t *testing.T) {
+	v := &Viz{}
+	cr := &closeReader{Reader: strings.NewReader("abc")}
+	r := v.AddSized("a", cr, 3)
+	if _, ok := r.(io.WriterTo); ok {
+		t.Error("wrapper implements WriterTo, which the underlying reader does not")
+	}
+	c, ok := r.(io.Closer)
+	if !ok {
+		t.Fatal("wrapper hides the Closer")
+	}
+	c.Close()
+	if !cr.closed {
+		t.Error("Close was not passed through")
+	}
+
+	if _, ok := v.AddSized("b", struct{ io.Reader }{cr}, 3).(io.Closer); ok {
+		t.Error("wrapper implements Closer, which the underlying reader does not")
+	}
+}
+
+func TestAddCountingConcurrent(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	r := v.AddCounting("stdin", io.LimitReader(zeros{}, 1<<20))
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				statusOf(v, "stdin")
+			}
+		}
+	}()
+	buf := make([]byte, 512)
+	for {
+		if _, err := r.Read(buf); err == io.EOF {
+			break
+		}
+	}
+	close(stop)
+	<-done
+
+	if st := statusOf(v, "stdin"); !strings.Contains(st, " 1.0 MB ") {
+		t.Errorf("status = %q, want 1.0 MB read", st)
+	}
+}
+
+// zeros is an endless reader of zero bytes.
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// failWriter accepts up to n bytes, then fails.
+type failWriter struct {
+	n   int
+	err error
+}
+
+func (w *failWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		n := w.n
+		w.n = 0
+		return n, w.err
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestAddWriter(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	var buf bytes.Buffer
+	w := v.AddWriter("out", &buf, 400)
+	if _, err := w.Write(make([]byte, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if st := statusOf(v, "out"); !strings.Contains(st, " 25.00% ") {
+		t.Errorf("status = %q, want 25.00%%", st)
+	}
+	if buf.Len() != 100 {
+		t.Errorf("wrote %d bytes through, want 100", buf.Len())
+	}
+}
+
+func TestAddWriterError(t *testing.T) {
+	errFull := errors.New("disk full")
+	v := newTestViz(newFakeClock())
+	w := v.AddWriter("out", &failWriter{n: 30, err: errFull}, 100)
+	n, err := w.Write(make([]byte, 50))
+	if n != 30 || err != errFull {
+		t.Errorf("Write = %d, %v, want 30, %v", n, err, errFull)
+	}
+	if st := statusOf(v, "out"); !strings.Contains(st, " 30.00% ") {
+		t.Errorf("status = %q, want the 30 bytes written counted", st)
+	}
+}
+
+func TestAddSection(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	data := bytes.NewReader(make([]byte, 10000))
+	// the second quarter of the file
+	r := v.AddSection("part2", io.NewSectionReader(data, 2500, 2500))
+
+	io.CopyN(io.Discard, r, 500)
+	statusOf(v, "part2")
+	if p := percent(v, "part2"); p != 20 {
+		t.Errorf("percent = %v after 500 of 2500 bytes, want 20", p)
+	}
+	r.Seek(2000, io.SeekStart)
+	statusOf(v, "part2")
+	if p := percent(v, "part2"); p != 80 {
+		t.Errorf("percent = %v after seeking to 2000, want 80", p)
+	}
+	if n, _ := io.Copy(io.Discard, r); n != 500 {
+		t.Errorf("read %d bytes past the section's end", n)
+	}
+	statusOf(v, "part2")
+	if p := percent(v, "part2"); p != 100 {
+		t.Errorf("percent = %v at the end of the section, want 100", p)
+	}
+}
+
+func TestAddSectionReadAt(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	data := bytes.NewReader(make([]byte, 10000))
+	r := v.AddSection("part", io.NewSectionReader(data, 5000, 1000))
+	if r.Size() != 1000 {
+		t.Fatalf("size = %d, want 1000", r.Size())
+	}
+
+	// chunks read in parallel
+	var wg sync.WaitGroup
+	for off := int64(0); off < 600; off += 100 {
+		wg.Add(1)
+		go func(off int64) {
+			defer wg.Done()
+			if _, err := r.ReadAt(make([]byte, 100), off); err != nil {
+				t.Error(err)
+			}
+		}(off)
+	}
+	wg.Wait()
+	statusOf(v, "part")
+	if p := percent(v, "part"); p != 60 {
+		t.Errorf("percent = %v after reading 600 of 1000 bytes, want 60", p)
+	}
+
+	n, err := r.ReadAt(make([]byte, 500), 800)
+	if n != 200 || err != io.EOF {
+		t.Errorf("ReadAt past the end read %d bytes with %v, want 200 and EOF", n, err)
+	}
+	statusOf(v, "part")
+	if p := percent(v, "part"); p != 80 {
+		t.Errorf("percent = %v, want 80", p)
+	}
+}
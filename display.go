@@ -0,0 +1,470 @@
+package parprog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nsf/termbox-go"
+)
+
+// ScrollMode selects which readers are shown when there are more readers than
+// terminal rows.
+type ScrollMode int
+
+const (
+	// ScrollClip shows the most recently added readers, and clips the rest.
+	ScrollClip ScrollMode = iota
+	// ScrollActiveFirst shows in-progress readers ahead of completed ones, so
+	// that active work stays visible.
+	ScrollActiveFirst
+	// ScrollPaged cycles through pages of readers every few refreshes.
+	ScrollPaged
+)
+
+// SortMode selects the order readers are displayed in. Whatever the order,
+// readers completed with an error are shown first.
+type SortMode int
+
+const (
+	// SortInsertion shows the most recently added readers first.
+	SortInsertion SortMode = iota
+	// SortName orders readers by name.
+	SortName
+	// SortPercent orders readers by percent complete, least complete first.
+	SortPercent
+	// SortStatus shows active readers ahead of completed ones.
+	SortStatus
+	// SortNearDone shows in-progress readers closest to completion first, so
+	// they can be watched finishing, with completed readers at the bottom.
+	SortNearDone
+)
+
+// SortBy sets the order readers are displayed in. The order readers were
+// added in is retained internally. It should be called before Start.
+func (v *Viz) SortBy(mode SortMode) {
+	v.sort = mode
+}
+
+// percentOf returns the percent completion of r, or 0 if it is unknown.
+func percentOf(r readInfo) float64 {
+	if r.Done {
+		return 100.0
+	}
+	return r.View.percent()
+}
+
+// statusRank orders readers as errored, active, then completed.
+func statusRank(r readInfo) int {
+	switch {
+	case r.Error != nil:
+		return 0
+	case !r.Done:
+		return 1
+	}
+	return 2
+}
+
+// pageFrames is the number of redraws each page is shown for in ScrollPaged.
+const pageFrames = 5
+
+// ScrollMode sets how readers are chosen for display when they do not all fit
+// in the terminal. It should be called before Start.
+func (v *Viz) ScrollMode(mode ScrollMode) {
+	v.scroll = mode
+}
+
+// visibleLocked returns at most n readers to be displayed, in display order.
+func (v *Viz) visibleLocked(n int) []readInfo {
+	if n <= 0 {
+		return nil
+	}
+	// newest readers first
+	rows := make([]readInfo, 0, len(v.readers))
+	for i := len(v.readers) - 1; i >= 0; i-- {
+		rows = append(rows, v.readers[i])
+	}
+
+	switch v.sort {
+	case SortName:
+		sort.SliceStable(rows, func(i, j int) bool {
+			return rows[i].label() < rows[j].label()
+		})
+	case SortPercent:
+		sort.SliceStable(rows, func(i, j int) bool {
+			return percentOf(rows[i]) < percentOf(rows[j])
+		})
+	case SortStatus:
+		sort.SliceStable(rows, func(i, j int) bool {
+			return statusRank(rows[i]) < statusRank(rows[j])
+		})
+	case SortNearDone:
+		sort.SliceStable(rows, func(i, j int) bool {
+			if rows[i].Done != rows[j].Done {
+				return !rows[i].Done
+			}
+			return !rows[i].Done && percentOf(rows[i]) > percentOf(rows[j])
+		})
+	}
+
+	if len(v.readers) > n && v.scroll == ScrollActiveFirst {
+		sort.SliceStable(rows, func(i, j int) bool {
+			return !rows[i].Done && rows[j].Done
+		})
+	}
+	// errored readers always come first, so that they are not missed
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].Error != nil && rows[j].Error == nil
+	})
+	// children are kept below their group regardless of the order
+	rows = v.withChildrenLocked(rows)
+	if len(rows) <= n {
+		return rows
+	}
+
+	switch v.scroll {
+	case ScrollPaged:
+		pages := (len(rows) + n - 1) / n
+		page := (v.redraws / pageFrames) % pages
+		rows = rows[page*n:]
+	}
+	if len(rows) > n {
+		rows = rows[:n]
+	}
+	return rows
+}
+
+// MaxLines limits the number of reader rows drawn, regardless of the terminal
+// height. When there are more readers than that, the last row instead shows
+// how many were left out, and the rest are chosen according to the ScrollMode.
+// The default of 0 uses as many rows as the terminal has. It should be called
+// before Start.
+func (v *Viz) MaxLines(n int) {
+	v.maxLines = n
+}
+
+// ErrorMode selects how error text too long for the terminal is drawn.
+type ErrorMode int
+
+const (
+	// ErrorClip cuts the error off at the edge of the terminal.
+	ErrorClip ErrorMode = iota
+	// ErrorEllipsis truncates the error with a trailing ellipsis, to show
+	// that there was more.
+	ErrorEllipsis
+	// ErrorWrap continues the error on the rows below the reader, as space
+	// allows.
+	ErrorWrap
+)
+
+// ErrorWrap sets how error text too long for the terminal is drawn. It should
+// be called before Start.
+func (v *Viz) ErrorWrap(mode ErrorMode) {
+	v.errMode = mode
+}
+
+// minWrapWidth is the narrowest a wrapped error is allowed to get before its
+// continuation rows are no longer aligned with the first.
+const minWrapWidth = 20
+
+// drawError draws the error text es starting at column x of row y, according
+// to the ErrorMode, without going past row maxY. It returns the row following
+// the error.
+func (v *Viz) drawError(f *frame, x, y, maxY int, es string, fg termbox.Attribute) int {
+	switch v.errMode {
+	case ErrorEllipsis:
+		rs := []rune(es)
+		if n := f.w - x; n > 0 && len(rs) > n {
+			es = string(rs[:n-1]) + ellipsis
+		}
+	case ErrorWrap:
+		indent := x
+		if f.w-indent < minWrapWidth {
+			indent = 4
+		}
+		rs := []rune(es)
+		for n := f.w - x; len(rs) > n && n > 0 && y+1 < maxY; n = f.w - indent {
+			f.drawString(x, y, string(rs[:n]), fg)
+			rs = rs[n:]
+			x = indent
+			y++
+		}
+		es = string(rs)
+	}
+	f.drawString(x, y, es, fg)
+	return y + 1
+}
+
+// compactReaders is the most readers shown on one line in CompactMode.
+const compactReaders = 3
+
+// CompactMode shows every reader on the header line, e.g.
+// "Elapsed 0:12, ... | a.txt 45% | b.txt 100%", while there are only a few of
+// them, switching back to a row per reader above that. It pairs well with
+// StartANSI. It should be called before Start.
+func (v *Viz) CompactMode(compact bool) {
+	v.compact = compact
+}
+
+// drawCompactLocked draws every reader on the first row of f, starting at
+// column x.
+func (v *Viz) drawCompactLocked(f *frame, x int, cs *ColorScheme) {
+	for _, r := range v.readers {
+		x = f.drawString(x, 0, " | ", cs.Header)
+		st := "running"
+		switch pct := percentOf(r); {
+		case r.Cancelled:
+			st = "cancelled"
+		case r.Error != nil:
+			st = "failed"
+		case r.Done || pct > 0:
+			st = fmt.Sprintf("%.0f%%", pct)
+		}
+		x = f.drawString(x, 0, r.label()+" "+st, cs.nameColor(r))
+	}
+}
+
+// ThroughputView replaces the status column with a bar showing each reader's
+// current byte rate relative to the fastest reader, so that lagging readers
+// stand out. Readers which do not count bytes, or have completed, show their
+// usual status. It should be called before Start.
+func (v *Viz) ThroughputView(show bool) {
+	v.throughput = show
+}
+
+// rateBarWidth is the width of the bars drawn by ThroughputView.
+const rateBarWidth = 12
+
+// throughputStatus returns the status column for r in ThroughputView, where
+// max is the highest rate of any reader.
+func throughputStatus(r readInfo, status string, max float64) string {
+	ss, ok := r.View.(sizedStatus)
+	if !ok || r.Done {
+		return fmt.Sprintf("%*s ", rateBarWidth+13, status)
+	}
+	rate := ss.progress().rate
+	pct := 0.0
+	if max > 0 {
+		pct = 100.0 * rate / max
+	}
+	return progressBar(pct, rateBarWidth) + fmt.Sprintf(" %10s/s ", formatBytes(rate))
+}
+
+// SetTitleProgress shows the overall progress in the terminal title, e.g.
+// "parprog 42% (12/40)", so that it can be followed from a minimized window or
+// background tab. The title is cleared again on Stop. It only applies to
+// StartANSI, and should be called before Start.
+func (v *Viz) SetTitleProgress(show bool) {
+	v.title = show
+}
+
+// titleLocked returns the terminal title for SetTitleProgress. The percent is
+// the mean of every reader's percent completion.
+func (v *Viz) titleLocked() string {
+	ndone := 0
+	pct := 0.0
+	for _, r := range v.readers {
+		if r.Done {
+			ndone++
+		}
+		pct += percentOf(r)
+	}
+	if len(v.readers) > 0 {
+		pct /= float64(len(v.readers))
+	}
+	return fmt.Sprintf("parprog %.0f%% (%d/%d)", pct, ndone, len(v.readers))
+}
+
+// NameWidth sets the width of the name column. Longer names are shortened
+// with an ellipsis in the middle, keeping the (usually meaningful) tail, and
+// shorter names are padded so following columns line up. The default of 0
+// leaves names as-is. It should be called before Start.
+func (v *Viz) NameWidth(n int) {
+	v.nameWidth = n
+}
+
+// fitName truncates or pads name to the configured name width.
+func (v *Viz) fitName(name string) string {
+	if v.nameWidth <= 0 {
+		return name
+	}
+	name = truncateMiddle(name, v.nameWidth)
+	return name + strings.Repeat(" ", v.nameWidth-utf8.RuneCountInString(name))
+}
+
+// defaultStatusWidth is the widest the status column grows unless StatusWidth
+// is called.
+const defaultStatusWidth = 40
+
+// StatusWidth sets the widest the status column may grow. The column is sized
+// to the longest status shown on each refresh, and longer statuses are
+// clipped with an ellipsis. It should be called before Start.
+func (v *Viz) StatusWidth(max int) {
+	v.statusMax = max
+}
+
+func (v *Viz) statusMaxWidth() int {
+	if v.statusMax <= 0 {
+		return defaultStatusWidth
+	}
+	return v.statusMax
+}
+
+// fitStatus right-aligns status in a column of the given width, clipping it
+// with an ellipsis if it is too long.
+func fitStatus(status string, width int) string {
+	rs := []rune(status)
+	if len(rs) > width {
+		return string(rs[:width-1]) + ellipsis
+	}
+	return strings.Repeat(" ", width-len(rs)) + status
+}
+
+// truncateMiddle shortens name to at most max runes by replacing its middle
+// with an ellipsis, e.g. "verylongpref…suffix.gz".
+func truncateMiddle(name string, max int) string {
+	rs := []rune(name)
+	if max <= 0 || len(rs) <= max {
+		return name
+	}
+	head := (max - 1) / 2
+	tail := max - 1 - head
+	return string(rs[:head]) + ellipsis + string(rs[len(rs)-tail:])
+}
+
+// SpinnerStyle sets the frames cycled through by spinners for readers of
+// unknown size, e.g. one of the SpinnerDots, SpinnerLine, SpinnerArrow or
+// SpinnerASCII presets. An empty frames restores the default Wheel. It should
+// be called before Start.
+func (v *Viz) SpinnerStyle(frames []rune) {
+	v.frames = frames
+}
+
+// ColorScheme holds the termbox attributes used to draw each part of the
+// display. The name column is drawn according to the reader's state.
+type ColorScheme struct {
+	Header    termbox.Attribute
+	Status    termbox.Attribute
+	Running   termbox.Attribute
+	Completed termbox.Attribute
+	Errored   termbox.Attribute
+	Cancelled termbox.Attribute
+	Error     termbox.Attribute // error text
+	Log       termbox.Attribute // messages from Viz.Log
+}
+
+// DefaultColors is the ColorScheme used unless Viz.Colors is called.
+var DefaultColors = ColorScheme{
+	Header:    termbox.ColorWhite,
+	Status:    termbox.ColorWhite,
+	Running:   termbox.ColorDefault,
+	Completed: termbox.ColorDefault,
+	Errored:   termbox.ColorDefault,
+	Cancelled: termbox.ColorYellow,
+	Error:     termbox.ColorRed | termbox.AttrBold,
+	Log:       termbox.ColorDefault,
+}
+
+// Colors sets the ColorScheme used to draw the display. It should be called
+// before Start.
+func (v *Viz) Colors(scheme ColorScheme) {
+	v.colors = &scheme
+}
+
+func (v *Viz) colorScheme() *ColorScheme {
+	if v.colors == nil {
+		return &DefaultColors
+	}
+	return v.colors
+}
+
+// nameColor returns the attribute for r's name based on its state.
+func (cs *ColorScheme) nameColor(r readInfo) termbox.Attribute {
+	switch {
+	case r.Cancelled:
+		return cs.Cancelled
+	case !r.Done:
+		return cs.Running
+	case r.Error != nil:
+		return cs.Errored
+	}
+	return cs.Completed
+}
+
+// Style configures how readers with a tag (see Viz.AddWithTag) are drawn.
+type Style struct {
+	Glyph string            // drawn ahead of the name, e.g. "Z"
+	Color termbox.Attribute // color of the glyph, and of the name while running
+}
+
+// TagStyle sets the Style used to draw readers added with the given tag. It
+// should be called before Start.
+func (v *Viz) TagStyle(tag string, style Style) {
+	if v.tags == nil {
+		v.tags = make(map[string]Style)
+	}
+	v.tags[tag] = style
+}
+
+// tagStyle returns the glyph (with a trailing space) to draw ahead of r's
+// name, and the color to draw the name in.
+func (v *Viz) tagStyle(r readInfo, cs *ColorScheme) (string, termbox.Attribute) {
+	color := cs.nameColor(r)
+	style, ok := v.tags[r.Tag]
+	if r.Tag == "" || !ok {
+		return "", color
+	}
+	if !r.Done && style.Color != termbox.ColorDefault {
+		color = style.Color
+	}
+	if style.Glyph == "" {
+		return "", color
+	}
+	return style.Glyph + " ", color
+}
+
+const (
+	// maxLogRows is the most log messages displayed below the readers.
+	maxLogRows = 5
+	// maxLogs is the most log messages retained.
+	maxLogs = 100
+)
+
+// stderr is where log messages go when there is no display to show them. It
+// is replaced in tests.
+var stderr io.Writer = os.Stderr
+
+// Log formats a message (as in fmt.Printf) and displays it in a scrolling
+// region below the readers, without corrupting the display. With StartWriter
+// the message is written out immediately, and before Start or after Stop it is
+// written to stderr. Messages still retained when the terminal is restored by
+// Stop are written to stderr too, so that they are not lost.
+func (v *Viz) Log(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if v.quit == nil {
+		fmt.Fprintln(stderr, msg)
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.logLocked(msg)
+}
+
+func (v *Viz) logLocked(msg string) {
+	if v.out != nil {
+		fmt.Fprintln(v.out, msg)
+		return
+	}
+	if !v.stopped.IsZero() {
+		// nothing is drawn any more
+		fmt.Fprintln(stderr, msg)
+		return
+	}
+	v.logs = append(v.logs, msg)
+	if len(v.logs) > maxLogs {
+		v.logs = append(v.logs[:0], v.logs[len(v.logs)-maxLogs:]...)
+	}
+}
@@ -0,0 +1,548 @@
+package parprog
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nsf/termbox-go"
+)
+
+// shownNames returns the last word of each reader row drawn for v, i.e. the
+// names of the readers shown, in display order.
+func shownNames(v *Viz, w, h int) []string {
+	var names []string
+	for _, line := range strings.Split(draw(v, w, h).String(), "\n")[1:] {
+		if f := strings.Fields(line); len(f) > 0 {
+			names = append(names, f[len(f)-1])
+		}
+	}
+	return names
+}
+
+func TestScrollActiveFirst(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	v.ScrollMode(ScrollActiveFirst)
+	for _, name := range manyNames(10) {
+		v.Add(name, nil)
+		if name != "name2" && name != "name5" {
+			v.Complete(name, nil)
+		}
+	}
+	got := shownNames(v, 40, 4)
+	if len(got) != 3 || got[0] != "name5" || got[1] != "name2" {
+		t.Errorf("shown %q, want the active name5 and name2 first", got)
+	}
+
+	// without scrolling the newest readers are shown
+	v.ScrollMode(ScrollClip)
+	if got := shownNames(v, 40, 4); !reflect.DeepEqual(got, []string{"name9", "name8", "name7"}) {
+		t.Errorf("clipped to %q", got)
+	}
+}
+
+func TestScrollPaged(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	v.ScrollMode(ScrollPaged)
+	for _, name := range manyNames(5) {
+		v.Add(name, nil)
+	}
+	want := [][]string{
+		{"name4", "name3"},
+		{"name2", "name1"},
+		{"name0"},
+		{"name4", "name3"},
+	}
+	for i, page := range want {
+		v.redraws = i * pageFrames
+		if got := shownNames(v, 40, 3); !reflect.DeepEqual(got, page) {
+			t.Errorf("page %d shows %q, want %q", i, got, page)
+		}
+	}
+}
+
+func TestMaxLines(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	v.MaxLines(3)
+	v.ScrollMode(ScrollActiveFirst)
+	for _, name := range manyNames(10) {
+		v.Add(name, nil)
+		if name != "name2" && name != "name5" {
+			v.Complete(name, nil)
+		}
+	}
+	m := draw(v, 40, 20)
+	if got := shownNames(v, 40, 20); len(got) != 3 || got[0] != "name5" || got[1] != "name2" {
+		t.Errorf("shown %q, want two rows led by the active readers", got)
+	}
+	if got := row(m, 3); got != ellipsis+" and 8 more" {
+		t.Errorf("summary row = %q", got)
+	}
+	if got := row(m, 4); got != "" {
+		t.Errorf("row 4 = %q, want nothing below the cap", got)
+	}
+
+	// a cap taller than the terminal has no effect
+	v.MaxLines(30)
+	if got := shownNames(v, 40, 5); len(got) != 4 {
+		t.Errorf("shown %q in a 5 row terminal", got)
+	}
+}
+
+func TestSortBy(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	v.Add("b", nil)
+	v.SetProgress("b", 0.5)
+	v.Add("a", nil)
+	v.Complete("a", nil)
+	v.Add("d", nil)
+	v.Complete("d", errors.New("failed"))
+	v.Add("c", nil)
+	v.SetProgress("c", 0.8)
+
+	tests := []struct {
+		mode SortMode
+		want string
+	}{
+		// errored readers always come first, shown here by their error
+		{SortInsertion, "failed c a b"},
+		{SortName, "failed a b c"},
+		{SortPercent, "failed b c a"},
+		{SortStatus, "failed c b a"},
+		{SortNearDone, "failed c b a"},
+	}
+	for _, tt := range tests {
+		v.SortBy(tt.mode)
+		if got := strings.Join(shownNames(v, 60, 10), " "); got != tt.want {
+			t.Errorf("SortBy(%d) shows %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+	if got := readerNames(v); !reflect.DeepEqual(got, []string{"b", "a", "d", "c"}) {
+		t.Errorf("sorting reordered the readers to %q", got)
+	}
+}
+
+func TestSortNearDone(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	v.SortBy(SortNearDone)
+	for name, frac := range map[string]float64{"p95": 0.95, "p10": 0.1, "p50": 0.5, "p92": 0.92, "p0": 0} {
+		v.Add(name, nil)
+		v.SetProgress(name, frac)
+	}
+	v.Add("done", nil)
+	v.Complete("done", nil)
+	want := "p95 p92 p50 p10 p0 done"
+	if got := strings.Join(shownNames(v, 60, 10), " "); got != want {
+		t.Errorf("shows %q, want %q", got, want)
+	}
+}
+
+func TestTruncateMiddle(t *testing.T) {
+	tests := []struct {
+		name string
+		max  int
+		want string
+	}{
+		{"verylongprefix-suffix.gz", 10, "very" + ellipsis + "ix.gz"},
+		{"verylongprefix-suffix.gz", 11, "veryl" + ellipsis + "ix.gz"},
+		{"abcdef", 6, "abcdef"},
+		{"abc", 6, "abc"},
+		{"abcdef", 0, "abcdef"},
+		{"héllo wörld", 6, "hé" + ellipsis + "rld"},
+	}
+	for _, tt := range tests {
+		if got := truncateMiddle(tt.name, tt.max); got != tt.want {
+			t.Errorf("truncateMiddle(%q, %d) = %q, want %q", tt.name, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestNameWidth(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	v.NameWidth(8)
+	v.Add("a/very/long/path.txt", nil)
+	v.Complete("a/very/long/path.txt", errors.New("oops"))
+	v.Add("short", nil)
+	v.Complete("short", errors.New("bad"))
+
+	m := draw(v, 60, 5)
+	long, short := row(m, 2), row(m, 1)
+	if !strings.HasSuffix(long, " a/v"+ellipsis+".txt oops") {
+		t.Errorf("long name row = %q", long)
+	}
+	// the name column is padded, so errors line up
+	if !strings.HasSuffix(short, " short    bad") {
+		t.Errorf("short name row = %q", short)
+	}
+}
+
+// cellAt returns the cell drawn at the start of the first occurrence of s in
+// row y of m.
+func cellAt(t *testing.T, m *memRenderer, y int, s string) termbox.Cell {
+	t.Helper()
+	i := strings.Index(row(m, y), s)
+	if i < 0 {
+		t.Fatalf("%q not found in row %q", s, row(m, y))
+	}
+	return m.Cell(utf8.RuneCountInString(row(m, y)[:i]), y)
+}
+
+// fixedStatus is a custom status showing its own text.
+type fixedStatus string
+
+func (s fixedStatus) ReadStatus() string { return string(s) }
+func (s fixedStatus) Done()              {}
+
+func TestStatusWidth(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	v.SortBy(SortName)
+	v.AddCustom("a", fixedStatus("ok"))
+	v.AddCustom("b", fixedStatus("12 MB/s"))
+	rows := func() []string {
+		var res []string
+		for _, line := range strings.Split(draw(v, 40, 5).String(), "\n")[1:] {
+			if line = strings.TrimRight(line, " "); line != "" {
+				res = append(res, line)
+			}
+		}
+		return res
+	}
+
+	// sized to the longest status, right-aligned
+	want := []string{"     ok a", "12 MB/s b"}
+	if got := rows(); !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %q, want %q", got, want)
+	}
+
+	// a long status is clipped to the maximum
+	v.StatusWidth(10)
+	v.AddCustom("c", fixedStatus("1.2 GB of 4.0 GB, ETA 0:42"))
+	want = []string{"        ok a", "   12 MB/s b", "1.2 GB of… c"}
+	if got := rows(); !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %q, want %q", got, want)
+	}
+}
+
+func TestColors(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	v.Colors(ColorScheme{
+		Header:    termbox.ColorBlue,
+		Status:    termbox.ColorMagenta,
+		Running:   termbox.ColorCyan,
+		Completed: termbox.ColorGreen,
+		Error:     termbox.ColorRed | termbox.AttrBold,
+	})
+	v.Add("running", nil)
+	v.Add("completed", nil)
+	v.Complete("completed", nil)
+	v.Add("errored", nil)
+	v.Complete("errored", errors.New("oops"))
+
+	m := draw(v, 60, 5)
+	tests := []struct {
+		y    int
+		s    string
+		want termbox.Attribute
+	}{
+		{0, "Elapsed", termbox.ColorBlue},
+		{1, "errored", termbox.ColorRed | termbox.AttrBold},
+		{1, "oops", termbox.ColorRed | termbox.AttrBold},
+		{2, "0:01", termbox.ColorMagenta},
+		{2, "completed", termbox.ColorGreen},
+		{3, "running", termbox.ColorCyan},
+	}
+	for _, tt := range tests {
+		if got := cellAt(t, m, tt.y, tt.s).Fg; got != tt.want {
+			t.Errorf("%q drawn in %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestLog(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	v.quit = make(chan int) // started
+	v.Add("reader", nil)
+	v.Log("hello %d", 1)
+	m := draw(v, 40, 6)
+	if got := row(m, 1); !strings.HasSuffix(got, " reader") {
+		t.Errorf("row 1 = %q, want the reader", got)
+	}
+	if got := row(m, 2); got != "hello 1" {
+		t.Errorf("row 2 = %q, want the log message", got)
+	}
+}
+
+func TestLogStderr(t *testing.T) {
+	var buf syncBuffer
+	defer func(w io.Writer) { stderr = w }(stderr)
+	stderr = &buf
+
+	v := &Viz{render: newMemRenderer(40, 6)}
+	v.Log("before")
+	if err := v.Start(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	v.Log("shown")
+	v.Stop()
+	v.Log("after")
+	// the final frame still shows "shown"
+	if got := buf.String(); got != "before\nafter\n" {
+		t.Errorf("stderr = %q", got)
+	}
+
+	buf = syncBuffer{}
+	v = &Viz{render: newMemRenderer(40, 6)}
+	if err := v.Start(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	v.Log("retained")
+	v.Pause()
+	v.Stop()
+	if got := buf.String(); got != "retained\n" {
+		t.Errorf("stderr = %q, want the message retained while paused", got)
+	}
+}
+
+func TestTagStyle(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	v.TagStyle("gz", Style{Glyph: "Z", Color: termbox.ColorYellow})
+	v.AddWithTag("a.gz", "gz", nil)
+	v.AddWithTag("b.gz", "gz", nil)
+	v.Complete("b.gz", nil)
+	v.AddWithTag("c.txt", "unknown", nil)
+
+	m := draw(v, 60, 5)
+	if got := row(m, 1); !strings.HasSuffix(got, " c.txt") || strings.Contains(got, "Z ") {
+		t.Errorf("unknown tag row = %q, want no glyph", got)
+	}
+	if got := row(m, 3); !strings.HasSuffix(got, " Z a.gz") {
+		t.Errorf("tagged row = %q, want the glyph ahead of the name", got)
+	}
+	tests := []struct {
+		y    int
+		s    string
+		want termbox.Attribute
+	}{
+		{3, "Z", termbox.ColorYellow},
+		{3, "a.gz", termbox.ColorYellow},
+		// completed readers use the usual color
+		{2, "Z", termbox.ColorYellow},
+		{2, "b.gz", DefaultColors.Completed},
+		{1, "c.txt", DefaultColors.Running},
+	}
+	for _, tt := range tests {
+		if got := cellAt(t, m, tt.y, tt.s).Fg; got != tt.want {
+			t.Errorf("%q in row %d drawn in %v, want %v", tt.s, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestCompactMode(t *testing.T) {
+	tests := []struct {
+		readers int
+		want    string // the header's suffix, or "" for a row per reader
+	}{
+		{1, " | name0 50%"},
+		{2, " | name0 50% | name1 running"},
+		{5, ""},
+	}
+	for _, tt := range tests {
+		v := newTestViz(newFakeClock())
+		v.CompactMode(true)
+		for _, name := range manyNames(tt.readers) {
+			v.Add(name, nil)
+		}
+		v.SetProgress("name0", 0.5)
+		m := draw(v, 120, 10)
+		header := row(m, 0)
+		if tt.want == "" {
+			if strings.Contains(header, "|") || len(shownNames(v, 120, 10)) != tt.readers {
+				t.Errorf("%d readers: header %q, want a row per reader", tt.readers, header)
+			}
+			continue
+		}
+		if !strings.HasSuffix(header, tt.want) {
+			t.Errorf("%d readers: header %q, want suffix %q", tt.readers, header, tt.want)
+		}
+		if got := row(m, 1); got != "" {
+			t.Errorf("%d readers: row 1 = %q, want only the header line", tt.readers, got)
+		}
+
+		// the full display for comparison
+		v.CompactMode(false)
+		if got := shownNames(v, 120, 10); len(got) != tt.readers {
+			t.Errorf("%d readers: full display shows %q", tt.readers, got)
+		}
+	}
+}
+
+func TestAddNamed(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	v.AddNamed("a/data.txt", "data.txt", nil)
+	v.AddNamed("b/data.txt", "data.txt", nil)
+	v.AddNamed("", "display-only", nil)
+	v.AddNamed("key-only", "", nil)
+
+	if v.Complete("data.txt", nil) {
+		t.Error("Complete found a reader by its display name")
+	}
+	if !v.Complete("b/data.txt", errors.New("failed")) {
+		t.Error("Complete did not find b/data.txt by key")
+	}
+	if err, _ := v.Error("a/data.txt"); err != nil {
+		t.Errorf("a/data.txt completed with %v", err)
+	}
+	if !v.Complete("display-only", nil) || !v.Complete("key-only", nil) {
+		t.Error("a reader added with one name was not found by it")
+	}
+
+	m := draw(v, 60, 6)
+	for _, s := range []string{" data.txt", "display-only", "key-only"} {
+		if !strings.Contains(m.String(), s) {
+			t.Errorf("display %q does not show %q", m.String(), s)
+		}
+	}
+	if strings.Contains(m.String(), "/data.txt") {
+		t.Errorf("display %q shows a key", m.String())
+	}
+}
+
+func TestRename(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	h := v.AddReader("file1", nil)
+	v.Add("file2", nil)
+	v.AddNamed("key", "shown", nil)
+
+	if v.Rename("missing", "other") {
+		t.Error("Rename found a reader that was never added")
+	}
+	if v.Rename("file1", "file2") {
+		t.Error("Rename took a name already in use")
+	}
+	if !v.Rename("file1", "dataset") {
+		t.Fatal("Rename did not find file1")
+	}
+	if h.Name() != "dataset" {
+		t.Errorf("handle name = %q, want dataset", h.Name())
+	}
+	if v.Complete("file1", nil) {
+		t.Error("Complete found a reader by its old name")
+	}
+	if !v.Complete("dataset", nil) {
+		t.Error("Complete did not find a reader by its new name")
+	}
+	if !v.Rename("key", "key2") {
+		t.Fatal("Rename did not find key")
+	}
+	if !v.Complete("key2", nil) {
+		t.Error("Complete did not find key2")
+	}
+
+	got := shownNames(v, 60, 6)
+	sort.Strings(got)
+	want := []string{"dataset", "file2", "shown"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("shown names = %q, want %q", got, want)
+	}
+}
+
+func TestThroughputView(t *testing.T) {
+	clk := newFakeClock()
+	v := newTestViz(clk)
+	v.ThroughputView(true)
+	fast := v.AddCounting("fast", strings.NewReader(strings.Repeat("x", 8<<10)))
+	slow := v.AddCounting("slow", strings.NewReader(strings.Repeat("x", 8<<10)))
+	v.Add("spinner", nil)
+	draw(v, 80, 5)
+	clk.advance(time.Second)
+	io.CopyN(io.Discard, fast, 4<<10)
+	io.CopyN(io.Discard, slow, 2<<10)
+	draw(v, 80, 5) // samples the rates
+
+	m := draw(v, 80, 5)
+	bar := func(name string) string {
+		for y := 1; y < 5; y++ {
+			if r := row(m, y); strings.HasSuffix(r, " "+name) {
+				if i := strings.Index(r, "["); i >= 0 {
+					return r[i : i+rateBarWidth]
+				}
+				return ""
+			}
+		}
+		t.Fatalf("%s not shown", name)
+		return ""
+	}
+	if got := bar("fast"); got != "[##########]" {
+		t.Errorf("fast bar = %q, want it full", got)
+	}
+	if got := bar("slow"); got != "[#####-----]" {
+		t.Errorf("slow bar = %q, want it half full", got)
+	}
+	if got := bar("spinner"); got != "" {
+		t.Errorf("spinner shows a bar %q", got)
+	}
+}
+
+func TestErrorWrap(t *testing.T) {
+	const msg = "abcdefghijklmnopqrstuvwxyz0123456789"
+	const prefix = "0:01 100.00% a " // 15 columns, leaving 15 for the error
+	tests := []struct {
+		mode ErrorMode
+		want []string
+	}{
+		{ErrorClip, []string{prefix + msg[:15], "0:00         b"}},
+		{ErrorEllipsis, []string{prefix + msg[:14] + ellipsis, "0:00         b"}},
+		// too narrow to align with the first row, so indented by 4
+		{ErrorWrap, []string{prefix + msg[:15], "    " + msg[15:], "0:00         b"}},
+	}
+	for _, tt := range tests {
+		v := newTestViz(newFakeClock())
+		v.ErrorWrap(tt.mode)
+		v.Add("b", nil)
+		v.Add("a", nil)
+		v.Complete("a", errors.New(msg))
+		m := draw(v, 30, 6)
+		for i, want := range tt.want {
+			if got := row(m, i+1); got != want {
+				t.Errorf("mode %d: row %d = %q, want %q", tt.mode, i+1, got, want)
+			}
+		}
+	}
+
+	// wrapping stops at the bottom of the terminal
+	v := newTestViz(newFakeClock())
+	v.ErrorWrap(ErrorWrap)
+	v.Add("a", nil)
+	v.Complete("a", errors.New(msg+msg))
+	m := draw(v, 30, 3)
+	if got := row(m, 2); got != "    "+(msg + msg)[15:41] {
+		t.Errorf("last row = %q", got)
+	}
+}
+
+func TestErrorRow(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	for _, name := range manyNames(6) {
+		v.Add(name, nil)
+	}
+	v.Complete("name0", nil)
+	v.Complete("name3", errors.New("corrupt"))
+
+	m := draw(v, 60, 8)
+	if got := row(m, 1); !strings.HasSuffix(got, " name3 corrupt") {
+		t.Fatalf("row 1 = %q, want the errored reader on top", got)
+	}
+	for x := 0; x < m.w; x++ {
+		if c := m.Cell(x, 1); c.Ch != ' ' && c.Fg != DefaultColors.Error {
+			t.Errorf("%q in column %d drawn in %v, want the whole row in %v", c.Ch, x, c.Fg, DefaultColors.Error)
+		}
+	}
+	if c := cellAt(t, m, 2, "name5"); c.Fg == DefaultColors.Error {
+		t.Error("the next row is highlighted too")
+	}
+}
@@ -0,0 +1,97 @@
+package parprog
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// event is a single JSON-lines progress event written to an EventSink.
+type event struct {
+	Name    string    `json:"name"`
+	Event   string    `json:"event"` // add, progress, complete or remove
+	Percent float64   `json:"percent"`
+	Elapsed float64   `json:"elapsed"` // seconds
+	Error   string    `json:"error,omitempty"`
+	TS      time.Time `json:"ts"`
+}
+
+// eventSink serializes events to a writer, one JSON object per line.
+type eventSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// EventSink sets a writer to receive one JSON object per line for every
+// reader state change, in addition to the normal display. Events look like:
+//
+//	{"name":"a.txt","event":"progress","percent":42.5,"elapsed":3,"ts":"..."}
+//
+// where event is one of "add", "progress", "complete" or "remove", elapsed is
+// in seconds, and error is only present for readers that failed. Progress
+// events are emitted for every active reader on each refresh. It should be
+// called before Start.
+func (v *Viz) EventSink(w io.Writer) {
+	v.events = &eventSink{enc: json.NewEncoder(w)}
+}
+
+// emit writes an event for r, if an EventSink has been set.
+func (v *Viz) emit(kind string, r readInfo) {
+	if v.events == nil {
+		return
+	}
+	ev := event{
+		Name:    r.Name,
+		Event:   kind,
+		Percent: percentOf(r),
+		Elapsed: r.View.elapsedTime().Seconds(),
+		TS:      v.now(),
+	}
+	if r.Error != nil {
+		ev.Error = r.Error.Error()
+	}
+
+	v.events.mu.Lock()
+	v.events.enc.Encode(ev)
+	v.events.mu.Unlock()
+}
+
+// emitProgressLocked writes a progress event for every active reader.
+func (v *Viz) emitProgressLocked() {
+	if v.events == nil {
+		return
+	}
+	for _, r := range v.readers {
+		if !r.Done {
+			v.emit("progress", r)
+		}
+	}
+}
+
+// OnAdd registers fn to be called whenever a reader is added. Callbacks are
+// run without any Viz locks held, so they may safely call back into the Viz.
+// It should be called before Start.
+func (v *Viz) OnAdd(fn func(name string)) {
+	v.onAdd = append(v.onAdd, fn)
+}
+
+// OnComplete registers fn to be called whenever a reader is completed, with
+// the error passed to Complete and the reader's total elapsed time. Callbacks
+// are run without any Viz locks held, so they may safely call back into the
+// Viz. It should be called before Start.
+func (v *Viz) OnComplete(fn func(name string, err error, elapsed time.Duration)) {
+	v.onComplete = append(v.onComplete, fn)
+}
+
+// OnInterrupt registers fn to be called when Ctrl-C is pressed. By default
+// Ctrl-C restores the terminal and exits the program with status 1, but once
+// a hook is registered the display keeps running and the program can decide
+// how to shut down (e.g. by cancelling a context and calling Stop). Each hook
+// is run in its own goroutine. It should be called before Start.
+//
+// The hooks are also run if the display stops itself because the terminal
+// can no longer be drawn to (e.g. after an ssh disconnect).
+func (v *Viz) OnInterrupt(fn func()) {
+	v.onInterrupt = append(v.onInterrupt, fn)
+}
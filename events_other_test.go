@@ -0,0 +1,31 @@
+//go:build !windows
+
+package parprog
+
+import (
+	"io"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestHandleSignals(t *testing.T) {
+	v := &Viz{}
+	fired := make(chan struct{}, 1)
+	v.OnInterrupt(func() { fired <- struct{}{} })
+	v.HandleSignals(syscall.SIGUSR1)
+	v.StartWriter(io.Discard, time.Hour)
+	defer v.Stop()
+
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Signal(syscall.SIGUSR1)
+	select {
+	case <-fired:
+	case <-time.After(time.Second):
+		t.Fatal("the hook did not fire for the signal")
+	}
+}
@@ -0,0 +1,123 @@
+package parprog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestEventSink(t *testing.T) {
+	clk := newFakeClock()
+	v := newTestViz(clk)
+	var buf bytes.Buffer
+	v.EventSink(&buf)
+
+	v.Add("a", nil)
+	v.SetProgress("a", 0.25)
+	clk.advance(2 * time.Second)
+	v.mu.Lock()
+	v.emitProgressLocked()
+	v.mu.Unlock()
+	v.Complete("a", errors.New("oops"))
+	v.Remove("a")
+
+	want := []event{
+		{Name: "a", Event: "add", TS: clk.now().Add(-2 * time.Second)},
+		{Name: "a", Event: "progress", Percent: 25, Elapsed: 2, TS: clk.now()},
+		{Name: "a", Event: "complete", Percent: 100, Elapsed: 2, Error: "oops", TS: clk.now()},
+		{Name: "a", Event: "remove", Percent: 100, Elapsed: 2, Error: "oops", TS: clk.now()},
+	}
+	if first, _, _ := bytes.Cut(buf.Bytes(), []byte("\n")); bytes.Contains(first, []byte(`"error"`)) {
+		t.Errorf("event without an error has an error field: %s", first)
+	}
+	sc := bufio.NewScanner(&buf)
+	i := 0
+	for ; sc.Scan(); i++ {
+		var got event
+		if err := json.Unmarshal(sc.Bytes(), &got); err != nil {
+			t.Fatalf("line %d is not JSON: %v: %s", i, err, sc.Bytes())
+		}
+		if i >= len(want) {
+			t.Fatalf("unexpected event %s", sc.Bytes())
+		}
+		if !got.TS.Equal(want[i].TS) {
+			t.Errorf("event %d at %v, want %v", i, got.TS, want[i].TS)
+		}
+		got.TS = want[i].TS
+		if got != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+	if i != len(want) {
+		t.Errorf("got %d events, want %d", i, len(want))
+	}
+}
+
+func TestCallbacks(t *testing.T) {
+	clk := newFakeClock()
+	v := newTestViz(clk)
+	var added, completed []string
+	var gotErr error
+	var gotElapsed time.Duration
+	v.OnAdd(func(name string) {
+		added = append(added, name)
+		// callbacks may call back into the Viz
+		v.Snapshot()
+	})
+	v.OnComplete(func(name string, err error, elapsed time.Duration) {
+		completed = append(completed, name)
+		gotErr, gotElapsed = err, elapsed
+		v.Remove(name)
+	})
+
+	errBad := errors.New("bad")
+	v.Add("a", nil)
+	v.Add("b", nil)
+	clk.advance(2 * time.Second)
+	v.Complete("b", errBad)
+
+	if len(added) != 2 || added[0] != "a" || added[1] != "b" {
+		t.Errorf("OnAdd called with %q", added)
+	}
+	if len(completed) != 1 || completed[0] != "b" || gotErr != errBad || gotElapsed != 2*time.Second {
+		t.Errorf("OnComplete called with %q, %v, %v", completed, gotErr, gotElapsed)
+	}
+	if names := readerNames(v); len(names) != 1 {
+		t.Errorf("readers = %q, want b removed by the callback", names)
+	}
+}
+
+func TestOnInterrupt(t *testing.T) {
+	v := &Viz{}
+	fired := make(chan struct{})
+	v.OnInterrupt(func() { close(fired) })
+	v.StartWriter(io.Discard, time.Hour)
+	defer v.Stop()
+
+	// as when Ctrl-C is pressed
+	if v.interrupt() {
+		t.Error("interrupt stopped the display despite the hook")
+	}
+	select {
+	case <-fired:
+	case <-time.After(time.Second):
+		t.Fatal("the hook did not fire")
+	}
+	select {
+	case <-v.done:
+		t.Error("the display stopped")
+	default:
+	}
+}
+
+func TestWatchSignalsStop(t *testing.T) {
+	v := &Viz{done: make(chan struct{})}
+	close(v.done) // as shutdown does
+	// the handler is removed once the display has stopped
+	within(t, time.Second, "watchSignals", func() { v.watchSignals(make(chan os.Signal)) })
+}
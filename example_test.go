@@ -0,0 +1,34 @@
+package parprog_test
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pbnjay/parprog"
+)
+
+// recordCounter shows the number of records parsed so far.
+type recordCounter struct {
+	n int64
+}
+
+func (c *recordCounter) ReadStatus() string {
+	return fmt.Sprintf("%d records", atomic.LoadInt64(&c.n))
+}
+
+func (c *recordCounter) Done() {}
+
+func ExampleViz_AddCustom() {
+	v := &parprog.Viz{}
+	rc := &recordCounter{}
+	v.AddCustom("data.csv", rc)
+
+	// as the parser makes progress
+	atomic.AddInt64(&rc.n, 1200)
+
+	// the first row is the header
+	rows := strings.Split(v.RenderString(), "\n")
+	fmt.Println(rows[1])
+	// Output: 1200 records data.csv
+}
@@ -0,0 +1,82 @@
+package parprog
+
+import (
+	"strconv"
+	"time"
+)
+
+// formatBytes returns a human-readable byte count, e.g. "12.4 MB".
+func formatBytes(n float64) string {
+	return string(appendBytes(nil, n))
+}
+
+// appendBytes appends the human-readable byte count n to b.
+func appendBytes(b []byte, n float64) []byte {
+	const units = "KMGTPE"
+	if n < 1024 {
+		b = strconv.AppendFloat(b, n, 'f', 0, 64)
+		return append(b, " B"...)
+	}
+	i := -1
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	b = strconv.AppendFloat(b, n, 'f', 1, 64)
+	return append(b, ' ', units[i], 'B')
+}
+
+// formatDuration formats d as "M:SS", or "H:MM:SS" when longer than an hour,
+// which reads better in a dense list than time.Duration.String.
+func formatDuration(d time.Duration) string {
+	return string(appendDuration(nil, d))
+}
+
+// appendDuration appends d formatted as in formatDuration to b.
+func appendDuration(b []byte, d time.Duration) []byte {
+	if d < 0 {
+		d = 0
+	}
+	secs := int64(d.Round(time.Second) / time.Second)
+	if secs >= 3600 {
+		b = strconv.AppendInt(b, secs/3600, 10)
+		b = append(b, ':')
+		b = appendTwoDigits(b, (secs/60)%60)
+	} else {
+		b = strconv.AppendInt(b, secs/60, 10)
+	}
+	b = append(b, ':')
+	return appendTwoDigits(b, secs%60)
+}
+
+// appendCount appends n to b with thousands separators, e.g. "10,000".
+func appendCount(b []byte, n int64) []byte {
+	if n < 0 {
+		b = append(b, '-')
+		n = -n
+	}
+	var tmp [20]byte
+	digits := strconv.AppendInt(tmp[:0], n, 10)
+	for i, c := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b = append(b, ',')
+		}
+		b = append(b, c)
+	}
+	return b
+}
+
+func appendTwoDigits(b []byte, n int64) []byte {
+	return append(b, byte('0'+n/10), byte('0'+n%10))
+}
+
+// appendPercent appends pct formatted as "%6.2f%%" to b.
+func appendPercent(b []byte, pct float64) []byte {
+	var tmp [24]byte
+	num := strconv.AppendFloat(tmp[:0], pct, 'f', 2, 64)
+	for i := len(num); i < 6; i++ {
+		b = append(b, ' ')
+	}
+	b = append(b, num...)
+	return append(b, '%')
+}
@@ -0,0 +1,28 @@
+package parprog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{-time.Second, "0:00"},
+		{0, "0:00"},
+		{400 * time.Millisecond, "0:00"},
+		{time.Second, "0:01"},
+		{time.Minute + 3*time.Second + 1, "1:03"},
+		{59*time.Minute + 59*time.Second, "59:59"},
+		{59*time.Minute + 59*time.Second + 600*time.Millisecond, "1:00:00"},
+		{time.Hour + 2*time.Minute + 5*time.Second, "1:02:05"},
+		{100*time.Hour + 30*time.Second, "100:00:30"},
+	}
+	for _, tt := range tests {
+		if got := formatDuration(tt.d); got != tt.want {
+			t.Errorf("formatDuration(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
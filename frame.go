@@ -0,0 +1,65 @@
+package parprog
+
+import "github.com/nsf/termbox-go"
+
+// cell is a single character on the screen.
+type cell struct {
+	ch rune
+	fg termbox.Attribute
+}
+
+var blankCell = cell{ch: ' ', fg: termbox.ColorDefault}
+
+// frame is an in-memory copy of the screen. Keeping the previous frame around
+// means only the cells which changed need to be sent to termbox, avoiding a
+// full Clear and redraw (and the resulting flicker) on every refresh.
+type frame struct {
+	w, h  int
+	cells []cell
+}
+
+func newFrame(w, h int) *frame {
+	f := &frame{w: w, h: h, cells: make([]cell, w*h)}
+	for i := range f.cells {
+		f.cells[i] = blankCell
+	}
+	return f
+}
+
+// drawString draws s starting at column x of row y, clipped to the width of
+// the frame, and returns the column following it.
+func (f *frame) drawString(x, y int, s string, fg termbox.Attribute) int {
+	if y < 0 || y >= f.h {
+		return x
+	}
+	for _, c := range s {
+		if x >= f.w {
+			break
+		}
+		f.cells[y*f.w+x] = cell{ch: c, fg: fg}
+		x++
+	}
+	return x
+}
+
+// flush sends the cells which differ from prev to r. If prev is nil or a
+// different size, the whole screen is redrawn.
+func (f *frame) flush(r renderer, prev *frame) error {
+	if prev == nil || prev.w != f.w || prev.h != f.h {
+		if err := r.Clear(blankCell.fg, termbox.ColorDefault); err != nil {
+			return err
+		}
+		for i, c := range f.cells {
+			if c != blankCell {
+				r.SetCell(i%f.w, i/f.w, c.ch, platformColor(c.fg), termbox.ColorDefault)
+			}
+		}
+	} else {
+		for i, c := range f.cells {
+			if c != prev.cells[i] {
+				r.SetCell(i%f.w, i/f.w, c.ch, platformColor(c.fg), termbox.ColorDefault)
+			}
+		}
+	}
+	return r.Flush()
+}
@@ -0,0 +1,117 @@
+package parprog
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nsf/termbox-go"
+)
+
+// countingRenderer counts the cells set on it.
+type countingRenderer struct {
+	w, h  int
+	cells int
+}
+
+func (c *countingRenderer) SetCell(x, y int, ch rune, fg, bg termbox.Attribute) { c.cells++ }
+func (c *countingRenderer) Clear(fg, bg termbox.Attribute) error                { return nil }
+func (c *countingRenderer) Flush() error                                        { return nil }
+func (c *countingRenderer) Size() (int, int)                                    { return c.w, c.h }
+
+// failingRenderer is a countingRenderer which cannot be flushed, as after the
+// terminal goes away.
+type failingRenderer struct {
+	countingRenderer
+	flushes int
+}
+
+func (f *failingRenderer) Flush() error {
+	f.flushes++
+	return errors.New("terminal gone")
+}
+
+// busyViz returns a Viz with n running readers.
+func busyViz(clk *fakeClock, n int) *Viz {
+	v := newTestViz(clk)
+	for i := 0; i < n; i++ {
+		v.Add(fmt.Sprintf("reader%03d", i), nil)
+	}
+	return v
+}
+
+// drawFrames draws frames of v onto r one second apart, diffing against the
+// previous frame if diff is set, and returns the number of cells set.
+func drawFrames(clk *fakeClock, v *Viz, r *countingRenderer, frames int, diff bool) int {
+	var prev *frame
+	for i := 0; i < frames; i++ {
+		clk.advance(time.Second)
+		v.mu.Lock()
+		f := v.drawLocked(r.w, r.h)
+		v.mu.Unlock()
+		if !diff {
+			prev = nil
+		}
+		f.flush(r, prev)
+		prev = f
+	}
+	return r.cells
+}
+
+func TestFrameDiff(t *testing.T) {
+	clk := newFakeClock()
+	v := busyViz(clk, 20)
+	full := drawFrames(clk, v, &countingRenderer{w: 80, h: 25}, 10, false)
+	diff := drawFrames(clk, v, &countingRenderer{w: 80, h: 25}, 10, true)
+	if diff >= full/2 {
+		t.Errorf("diffing set %d cells, full redraws %d", diff, full)
+	}
+
+	// an unchanged frame sets nothing
+	v.mu.Lock()
+	f := v.drawLocked(80, 25)
+	v.mu.Unlock()
+	r := &countingRenderer{w: 80, h: 25}
+	f.flush(r, f)
+	if r.cells != 0 {
+		t.Errorf("flushing an unchanged frame set %d cells", r.cells)
+	}
+}
+
+func BenchmarkRedraw(b *testing.B) {
+	for _, bm := range []struct {
+		name string
+		diff bool
+	}{{"full", false}, {"diff", true}} {
+		b.Run(bm.name, func(b *testing.B) {
+			clk := newFakeClock()
+			v := busyViz(clk, 100)
+			r := &countingRenderer{w: 120, h: 50}
+			drawFrames(clk, v, r, b.N, bm.diff)
+			b.ReportMetric(float64(r.cells)/float64(b.N), "cells/op")
+		})
+	}
+}
+
+func TestFlushErrorStops(t *testing.T) {
+	r := &failingRenderer{countingRenderer: countingRenderer{w: 60, h: 5}}
+	v := NewViz(withRenderer(r), WithInterval(time.Millisecond))
+	interrupted := make(chan struct{})
+	v.OnInterrupt(func() { close(interrupted) })
+	v.Add("reader", nil)
+	if err := v.Start(0); err != nil {
+		t.Fatal(err)
+	}
+	within(t, 5*time.Second, "the display loop", func() { <-v.done })
+	within(t, 5*time.Second, "the interrupt hook", func() { <-interrupted })
+	v.Stop()
+
+	// one more for the final frame drawn by shutdown
+	if r.flushes != maxDrawErrors+1 {
+		t.Errorf("%d flushes, want %d", r.flushes, maxDrawErrors+1)
+	}
+	if v.stopped.IsZero() {
+		t.Error("the display was not marked as stopped")
+	}
+}
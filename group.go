@@ -0,0 +1,153 @@
+package parprog
+
+import "time"
+
+// Group is a reader displayed with child readers indented below it, e.g. an
+// archive and the files inside it. Its percent completion is the average of
+// its children's, and once it is closed it is completed automatically when all
+// of its children have been.
+type Group struct {
+	v *Viz
+	h *ReaderHandle
+}
+
+// AddGroup adds a parent reader to the Viz, to which children can be added
+// with AddChild.
+func (v *Viz) AddGroup(name string) *Group {
+	gs := &groupStatus{clock: newClock()}
+	info := readInfo{Name: name, View: gs}
+	info.Handle = &ReaderHandle{name: name, group: gs}
+	v.add(info)
+	return &Group{v: v, h: info.Handle}
+}
+
+// AddChild adds a reader below the group, as in AddReader.
+func (g *Group) AddChild(name string, rdr interface{}) *ReaderHandle {
+	info := newReadInfo(name, rdr)
+	info.Handle = &ReaderHandle{name: name}
+	info.Parent = g.h
+	g.v.add(info)
+	return info.Handle
+}
+
+// Close marks the group as having all of its children, so that it is completed
+// as soon as they have all been completed, or immediately if they already
+// have. No more children should be added after Close. A group which is never
+// closed must be completed with CompleteHandle.
+func (g *Group) Close() {
+	v := g.v
+	v.mu.Lock()
+	g.h.group.closed = true
+	done := v.childrenDoneLocked(g.h)
+	v.mu.Unlock()
+	if done {
+		v.CompleteHandle(g.h, nil)
+	}
+}
+
+// closedDoneLocked reports whether p is a closed group whose children have all
+// been completed, so that it should be completed too.
+func (v *Viz) closedDoneLocked(p *ReaderHandle) bool {
+	return p != nil && p.group != nil && p.group.closed && v.childrenDoneLocked(p)
+}
+
+// Handle returns the handle of the group's own reader, e.g. to complete it
+// with an error using CompleteHandle.
+func (g *Group) Handle() *ReaderHandle {
+	return g.h
+}
+
+// childrenDoneLocked reports whether every child of the group p has been
+// completed.
+func (v *Viz) childrenDoneLocked(p *ReaderHandle) bool {
+	for _, r := range v.readers {
+		if r.Parent == p && !r.Done {
+			return false
+		}
+	}
+	return true
+}
+
+// withChildrenLocked returns the top-level readers in rows, each followed by
+// its children in the order they were added.
+func (v *Viz) withChildrenLocked(rows []readInfo) []readInfo {
+	res := make([]readInfo, 0, len(v.readers))
+	for _, r := range rows {
+		if r.Parent != nil {
+			continue
+		}
+		res = append(res, r)
+		if r.Handle == nil || r.Handle.group == nil {
+			continue
+		}
+		for _, c := range v.readers {
+			if c.Parent == r.Handle {
+				res = append(res, c)
+			}
+		}
+	}
+	return res
+}
+
+//////////
+
+// groupStatus shows the average progress of a group's children.
+type groupStatus struct {
+	statusBuf
+	clock
+	elapsed  time.Duration
+	children []readStatusInterface
+	closed   bool // set by Group.Close, guarded by the Viz mutex
+}
+
+func (g *groupStatus) ReadStatus() string {
+	if g.elapsed != 0 {
+		return g.finalStatus(g.elapsed)
+	}
+	b := append(g.buf[:0], g.duration(g.sinceStart())...)
+	b = append(b, ' ')
+	b = appendPercent(b, g.percent())
+	g.buf = b
+	return string(b)
+}
+
+func (g *groupStatus) Done() {
+	if g.elapsed != 0 {
+		return
+	}
+	g.elapsed = g.sinceStart()
+	if g.elapsed == 0 {
+		g.elapsed = time.Second
+	}
+}
+
+func (g *groupStatus) percent() float64 {
+	if g.elapsed != 0 {
+		return 100.0
+	}
+	if len(g.children) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, c := range g.children {
+		sum += c.percent()
+	}
+	return sum / float64(len(g.children))
+}
+
+func (g *groupStatus) elapsedTime() time.Duration {
+	if g.elapsed != 0 {
+		return g.elapsed
+	}
+	return g.sinceStart()
+}
+
+// removeChild stops counting view towards the group's progress.
+func (g *groupStatus) removeChild(view readStatusInterface) {
+	for i, c := range g.children {
+		if c == view {
+			g.children = append(g.children[:i], g.children[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package parprog
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// groupDone reports whether the group's own reader has been completed.
+func groupDone(v *Viz, g *Group) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, r := range v.readers {
+		if r.Handle == g.Handle() {
+			return r.Done
+		}
+	}
+	return false
+}
+
+func TestGroupPercent(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	g := v.AddGroup("archive")
+	g.AddChild("a", nil)
+	g.AddChild("b", nil)
+	v.SetProgress("a", 0.5)
+	v.SetProgress("b", 0.25)
+	if p := percent(v, "archive"); p != 37.5 {
+		t.Errorf("group percent = %v, want the average 37.5", p)
+	}
+	v.Complete("b", nil)
+	if p := percent(v, "archive"); p != 75 {
+		t.Errorf("group percent = %v, want 75 with b complete", p)
+	}
+	v.Remove("a")
+	if p := percent(v, "archive"); p != 100 {
+		t.Errorf("group percent = %v, want 100 once a is removed", p)
+	}
+}
+
+func TestGroupIndent(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	g := v.AddGroup("archive")
+	g.AddChild("inner1", nil)
+	v.Add("other", nil)
+	g.AddChild("inner2", nil)
+
+	lines := strings.Split(draw(v, 60, 5).String(), "\n")[1:]
+	var names []string
+	col := map[string]int{}
+	for _, line := range lines {
+		if f := strings.Fields(line); len(f) > 0 {
+			name := f[len(f)-1]
+			names = append(names, name)
+			col[name] = strings.LastIndex(line, name)
+		}
+	}
+	want := "other archive inner1 inner2"
+	if got := strings.Join(names, " "); got != want {
+		t.Fatalf("rows show %q, want %q", got, want)
+	}
+	if col["other"] != col["archive"] || col["inner1"] <= col["archive"] || col["inner2"] != col["inner1"] {
+		t.Errorf("names start in columns %v, want the children indented", col)
+	}
+}
+
+func TestGroupSequential(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	g := v.AddGroup("archive")
+
+	// each child is added and completed before the next
+	for _, name := range manyNames(3) {
+		g.AddChild(name, nil)
+		v.Complete(name, nil)
+		if groupDone(v, g) {
+			t.Fatalf("group completed after %s, before Close", name)
+		}
+	}
+	g.Close()
+	if !groupDone(v, g) {
+		t.Error("group not completed by Close with all children done")
+	}
+}
+
+func TestGroupClose(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	g := v.AddGroup("archive")
+	g.AddChild("a", nil)
+	g.AddChild("b", nil)
+	g.AddChild("c", nil)
+	g.Close()
+
+	v.Complete("a", nil)
+	if groupDone(v, g) {
+		t.Fatal("group completed with children still running")
+	}
+	v.Complete("b", errors.New("failed"))
+	v.Remove("c")
+	if !groupDone(v, g) {
+		t.Error("group not completed once the last child was removed")
+	}
+}
+
+func TestGroupCompleteHandle(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	g := v.AddGroup("archive")
+	g.AddChild("a", nil)
+	errBad := errors.New("bad archive")
+	v.CompleteHandle(g.Handle(), errBad)
+	if err, _ := v.Error("archive"); err != errBad {
+		t.Errorf("group completed with %v, want %v", err, errBad)
+	}
+}
@@ -0,0 +1,38 @@
+package parprog
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// AddHTTP adds the body of an HTTP response to the Viz, showing percent
+// completion of its Content-Length, or a spinner with the bytes read so far if
+// the length is unknown. The returned io.ReadCloser must be used in place of
+// resp.Body. Closing it closes resp.Body and completes the reader, so to show
+// an error, call Complete before Close.
+func (v *Viz) AddHTTP(name string, resp *http.Response) io.ReadCloser {
+	cr := newCountingReader(resp.Body, resp.ContentLength)
+	h := &ReaderHandle{name: name}
+	v.add(readInfo{Name: name, View: cr, Handle: h})
+	return &httpBody{r: cr, body: resp.Body, v: v, h: h}
+}
+
+// httpBody completes its reader when the response body is closed.
+type httpBody struct {
+	r    *countingReader
+	body io.Closer
+	v    *Viz
+	h    *ReaderHandle
+	once sync.Once
+}
+
+func (b *httpBody) Read(p []byte) (int, error) {
+	return b.r.Read(p)
+}
+
+func (b *httpBody) Close() error {
+	err := b.body.Close()
+	b.once.Do(func() { b.v.CompleteHandle(b.h, nil) })
+	return err
+}
@@ -0,0 +1,94 @@
+package parprog
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// snapshot returns the status of the named reader.
+func snapshot(v *Viz, name string) ReaderStatus {
+	for _, rs := range v.Snapshot() {
+		if rs.Name == name {
+			return rs
+		}
+	}
+	return ReaderStatus{}
+}
+
+func TestAddHTTP(t *testing.T) {
+	data := strings.Repeat("x", 1000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		io.WriteString(w, data)
+	}))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ContentLength != 1000 {
+		t.Fatalf("Content-Length = %d, want 1000", resp.ContentLength)
+	}
+
+	v := newTestViz(newFakeClock())
+	body := v.AddHTTP("data", resp)
+	if _, err := io.ReadFull(body, make([]byte, 250)); err != nil {
+		t.Fatal(err)
+	}
+	if st := statusOf(v, "data"); !strings.Contains(st, " 25.00% ") {
+		t.Errorf("status = %q, want 25.00%%", st)
+	}
+	if p := percent(v, "data"); p != 25 {
+		t.Errorf("percent = %v, want 25", p)
+	}
+
+	io.Copy(io.Discard, body)
+	if snapshot(v, "data").Done {
+		t.Error("the reader completed before the body was closed")
+	}
+	if err := body.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if rs := snapshot(v, "data"); !rs.Done || rs.Percent != 100 || rs.Err != nil {
+		t.Errorf("after Close, status = %+v, want completed", rs)
+	}
+	if _, err := resp.Body.Read(make([]byte, 1)); err == nil || err == io.EOF {
+		t.Errorf("read after Close returned %v, want the body closed", err)
+	}
+}
+
+func TestAddHTTPUnknownLength(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// flushing before the end forces a chunked response
+		io.WriteString(w, strings.Repeat("x", 500))
+		w.(http.Flusher).Flush()
+		io.WriteString(w, strings.Repeat("x", 500))
+	}))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ContentLength != -1 {
+		t.Fatalf("Content-Length = %d, want -1", resp.ContentLength)
+	}
+
+	v := newTestViz(newFakeClock())
+	body := v.AddHTTP("data", resp)
+	io.Copy(io.Discard, body)
+	st := statusOf(v, "data")
+	if strings.Contains(st, "%") || !strings.Contains(st, "1000 B") {
+		t.Errorf("status = %q, want a spinner with the bytes read", st)
+	}
+	if p := percent(v, "data"); p != 0 {
+		t.Errorf("percent = %v, want 0 until completed", p)
+	}
+	body.Close()
+	if rs := snapshot(v, "data"); !rs.Done {
+		t.Errorf("after Close, status = %+v, want completed", rs)
+	}
+}
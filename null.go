@@ -0,0 +1,23 @@
+package parprog
+
+// Progress is the subset of Viz methods used by code reporting progress, so
+// that such code can be tested with NewNullViz instead of a terminal.
+type Progress interface {
+	Add(name string, rdr interface{})
+	Complete(name string, err error) bool
+	Remove(name string)
+}
+
+var _ Progress = (*Viz)(nil)
+
+// NewNullViz returns a Progress whose methods do nothing. Complete always
+// reports that the reader was found.
+func NewNullViz() Progress {
+	return nullViz{}
+}
+
+type nullViz struct{}
+
+func (nullViz) Add(name string, rdr interface{})     {}
+func (nullViz) Complete(name string, err error) bool { return true }
+func (nullViz) Remove(name string)                   {}
@@ -0,0 +1,20 @@
+package parprog
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestNullViz(t *testing.T) {
+	p := NewNullViz()
+	for _, rdr := range []interface{}{nil, os.Stdin, strings.NewReader("x"), 42} {
+		p.Add("reader", rdr)
+	}
+	if !p.Complete("reader", nil) || !p.Complete("missing", errors.New("failed")) {
+		t.Error("Complete reported a reader was not found")
+	}
+	p.Remove("reader")
+	p.Remove("missing")
+}
@@ -0,0 +1,46 @@
+package parprog
+
+import (
+	"io"
+	"time"
+)
+
+// Option configures a Viz created with NewViz.
+type Option func(*Viz)
+
+// NewViz returns a Viz configured by opts, ready to be Start()-ed. It is an
+// alternative to calling the individual setters on a zero value Viz.
+func NewViz(opts ...Option) *Viz {
+	v := &Viz{}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// WithInterval sets the refresh interval used when Start is given an interval
+// <= 0.
+func WithInterval(d time.Duration) Option {
+	return func(v *Viz) { v.interval = d }
+}
+
+// WithColors sets the ColorScheme, as in Viz.Colors.
+func WithColors(scheme ColorScheme) Option {
+	return func(v *Viz) { v.Colors(scheme) }
+}
+
+// WithSort sets the order readers are displayed in, as in Viz.SortBy.
+func WithSort(mode SortMode) Option {
+	return func(v *Viz) { v.SortBy(mode) }
+}
+
+// WithOutput sets where text displays are written, as in Viz.Output.
+func WithOutput(w io.Writer) Option {
+	return func(v *Viz) { v.Output(w) }
+}
+
+// withRenderer draws the display on r instead of the terminal, e.g. to capture
+// frames in tests. Start then uses r regardless of the display mode.
+func withRenderer(r renderer) Option {
+	return func(v *Viz) { v.render = r }
+}
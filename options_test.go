@@ -0,0 +1,49 @@
+package parprog
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nsf/termbox-go"
+)
+
+func TestNewViz(t *testing.T) {
+	m := newMemRenderer(60, 5)
+	v := NewViz(
+		WithInterval(time.Hour),
+		WithColors(ColorScheme{Header: termbox.ColorBlue}),
+		WithSort(SortName),
+		withRenderer(m),
+	)
+	v.Add("b", nil)
+	v.Add("a", nil)
+	if err := v.Start(0); err != nil {
+		t.Fatal(err)
+	}
+	v.Stop()
+
+	if v.interval != time.Hour {
+		t.Errorf("interval = %v, want 1h", v.interval)
+	}
+	if got := strings.Fields(row(m, 1)); len(got) == 0 || got[len(got)-1] != "a" {
+		t.Errorf("first row = %q, want a sorted by name", row(m, 1))
+	}
+	if got := cellAt(t, m, 0, "Elapsed").Fg; got != termbox.ColorBlue {
+		t.Errorf("header drawn in %v, want %v", got, termbox.ColorBlue)
+	}
+}
+
+func TestNewVizOutput(t *testing.T) {
+	var buf syncBuffer
+	v := NewViz(WithOutput(&buf))
+	v.ForceMode(ModePlain)
+	if err := v.Start(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	v.Add("a.txt", nil)
+	v.Stop()
+	if !strings.Contains(buf.String(), "a.txt") {
+		t.Errorf("output = %q, want the reader listed", buf.String())
+	}
+}
@@ -0,0 +1,160 @@
+package parprog
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrPoolClosed is returned by BoundedPool.Submit after Drain or Shutdown.
+var ErrPoolClosed = errors.New("parprog: pool is closed")
+
+// BoundedPool runs submitted tasks in the background, with a limit on the
+// number of tasks running concurrently which can be changed at any time (for
+// example to dial throughput up or down based on observed I/O contention).
+type BoundedPool struct {
+	mu     sync.Mutex
+	idle   *sync.Cond
+	limit  int
+	active int
+	queue  []poolTask
+
+	running []*poolTask // in the order they started
+	closed  bool
+
+	panicked *PanicError
+}
+
+type poolTask struct {
+	name string
+	fn   func(string)
+}
+
+// NewBoundedPool creates a pool running at most n tasks concurrently. As with
+// BoundedExec, n <= 0 is treated as 1.
+func NewBoundedPool(n int) *BoundedPool {
+	if n < 1 {
+		n = 1
+	}
+	p := &BoundedPool{limit: n}
+	p.idle = sync.NewCond(&p.mu)
+	return p
+}
+
+// Submit queues fn(name) to be run as soon as the concurrency limit allows.
+// After Drain or Shutdown the task is not run, and ErrPoolClosed is returned.
+func (p *BoundedPool) Submit(name string, fn func(string)) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrPoolClosed
+	}
+	p.queue = append(p.queue, poolTask{name: name, fn: fn})
+	p.dispatchLocked()
+	return nil
+}
+
+// SetLimit changes the maximum number of concurrent tasks. If the limit grows,
+// queued tasks are started immediately. If it shrinks, running tasks are
+// allowed to finish and no new tasks start until the count drops below n.
+func (p *BoundedPool) SetLimit(n int) {
+	if n < 1 {
+		n = 1
+	}
+	p.mu.Lock()
+	p.limit = n
+	p.dispatchLocked()
+	p.mu.Unlock()
+}
+
+// Wait blocks until every submitted task has finished. As with BoundedExec, a
+// panicking task does not stop the others; instead its *PanicError is passed
+// to OnPanic, or if that is not set, Wait panics with the first one.
+func (p *BoundedPool) Wait() {
+	p.mu.Lock()
+	for p.active > 0 || len(p.queue) > 0 {
+		p.idle.Wait()
+	}
+	pe := p.panicked
+	p.panicked = nil
+	p.mu.Unlock()
+	if pe != nil {
+		panic(pe)
+	}
+}
+
+// InFlight returns the names of the tasks currently running, in the order
+// they started, e.g. to report what a stuck run is waiting on.
+func (p *BoundedPool) InFlight() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	names := make([]string, len(p.running))
+	for i, t := range p.running {
+		names[i] = t.name
+	}
+	return names
+}
+
+// Drain stops accepting new tasks, then waits for every task already
+// submitted to finish, as in Wait.
+func (p *BoundedPool) Drain() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	p.Wait()
+}
+
+// Shutdown stops accepting new tasks and discards those which have not yet
+// started, then waits for the running tasks to finish, as in Wait.
+func (p *BoundedPool) Shutdown() {
+	p.mu.Lock()
+	p.closed = true
+	for i := range p.queue {
+		p.queue[i] = poolTask{}
+	}
+	p.queue = nil
+	p.mu.Unlock()
+	p.Wait()
+}
+
+func (p *BoundedPool) dispatchLocked() {
+	for p.active < p.limit && len(p.queue) > 0 {
+		t := p.queue[0]
+		p.queue[0] = poolTask{}
+		p.queue = p.queue[1:]
+		p.active++
+		p.running = append(p.running, &t)
+		go p.run(&t)
+	}
+}
+
+func (p *BoundedPool) run(t *poolTask) {
+	defer func() {
+		var pe *PanicError
+		if r := recover(); r != nil {
+			pe = newPanicError(t.name, r)
+			if OnPanic != nil {
+				OnPanic(pe)
+				pe = nil
+			}
+		}
+
+		p.mu.Lock()
+		if pe != nil && p.panicked == nil {
+			p.panicked = pe
+		}
+		p.active--
+		for i, rt := range p.running {
+			if rt == t {
+				p.running = append(p.running[:i], p.running[i+1:]...)
+				break
+			}
+		}
+		p.dispatchLocked()
+		if p.active == 0 && len(p.queue) == 0 {
+			p.idle.Broadcast()
+		}
+		p.mu.Unlock()
+	}()
+
+	t.fn(t.name)
+}
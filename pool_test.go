@@ -0,0 +1,131 @@
+package parprog
+
+import (
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingTask returns a pool task which runs until a value is sent on gate.
+func blockingTask(g *gauge, gate chan struct{}) func(string) {
+	return func(string) {
+		g.enter()
+		defer g.leave()
+		<-gate
+	}
+}
+
+func TestBoundedPoolSetLimit(t *testing.T) {
+	var g gauge
+	gate := make(chan struct{})
+	p := NewBoundedPool(2)
+	for _, name := range manyNames(10) {
+		p.Submit(name, blockingTask(&g, gate))
+	}
+	running := func(n int) func() bool {
+		return func() bool {
+			return len(p.InFlight()) == n && atomic.LoadInt64(&g.cur) == int64(n)
+		}
+	}
+	waitFor(t, "2 tasks to run", running(2))
+
+	p.SetLimit(4)
+	waitFor(t, "4 tasks to run", running(4))
+
+	// running tasks finish, and only one at a time replaces them
+	p.SetLimit(1)
+	for i := 0; i < 4; i++ {
+		gate <- struct{}{}
+	}
+	waitFor(t, "the running tasks to drop to 1", running(1))
+	for i := 0; i < 6; i++ {
+		if n := len(p.InFlight()); n != 1 {
+			t.Fatalf("%d tasks running after shrinking the limit to 1", n)
+		}
+		gate <- struct{}{}
+	}
+	p.Wait()
+	if g.max != 4 {
+		t.Errorf("at most %d tasks ran at once, want 4", g.max)
+	}
+}
+
+func TestBoundedPoolInFlight(t *testing.T) {
+	var g gauge
+	gate := make(chan struct{})
+	p := NewBoundedPool(3)
+	if got := p.InFlight(); len(got) != 0 {
+		t.Errorf("InFlight = %q before any tasks", got)
+	}
+	for _, name := range manyNames(5) {
+		p.Submit(name, blockingTask(&g, gate))
+	}
+	waitFor(t, "3 tasks to run", func() bool { return atomic.LoadInt64(&g.cur) == 3 })
+	if got := p.InFlight(); !reflect.DeepEqual(got, []string{"name0", "name1", "name2"}) {
+		t.Errorf("InFlight = %q, want the first 3 names", got)
+	}
+	close(gate)
+	p.Wait()
+	if got := p.InFlight(); len(got) != 0 {
+		t.Errorf("InFlight = %q after Wait", got)
+	}
+}
+
+// closedPool submits 5 tasks to a pool running 2 at a time, closes it with
+// stop once 2 are running, and returns how many tasks ran and the error
+// from submitting another.
+func closedPool(t *testing.T, stop func(*BoundedPool)) (int64, error) {
+	var g gauge
+	var ran int64
+	gate := make(chan struct{})
+	p := NewBoundedPool(2)
+	for _, name := range manyNames(5) {
+		p.Submit(name, func(name string) {
+			blockingTask(&g, gate)(name)
+			atomic.AddInt64(&ran, 1)
+		})
+	}
+	waitFor(t, "2 tasks to run", func() bool { return atomic.LoadInt64(&g.cur) == 2 })
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		stop(p)
+	}()
+	waitFor(t, "the pool to close", func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.closed
+	})
+	go func() {
+		for {
+			select {
+			case gate <- struct{}{}:
+			case <-done:
+				return
+			}
+		}
+	}()
+	within(t, time.Second, "closing", func() { <-done })
+	return atomic.LoadInt64(&ran), p.Submit("later", func(string) {})
+}
+
+func TestBoundedPoolDrain(t *testing.T) {
+	ran, err := closedPool(t, (*BoundedPool).Drain)
+	if ran != 5 {
+		t.Errorf("%d of 5 tasks ran, want all of them drained", ran)
+	}
+	if err != ErrPoolClosed {
+		t.Errorf("Submit after Drain returned %v", err)
+	}
+}
+
+func TestBoundedPoolShutdown(t *testing.T) {
+	ran, err := closedPool(t, (*BoundedPool).Shutdown)
+	if ran != 2 {
+		t.Errorf("%d of 5 tasks ran, want only the 2 running", ran)
+	}
+	if err != ErrPoolClosed {
+		t.Errorf("Submit after Shutdown returned %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package parprog
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// Records reports the progress of a reader added with AddRecords. Its methods
+// are safe to call from the goroutine doing the work.
+type Records struct {
+	rs *recordStatus
+}
+
+// AddRecords adds a reader whose progress is counted in records (e.g. lines
+// or rows) rather than bytes, out of the given total. A total <= 0 is treated
+// as unknown, and only the count is shown alongside a spinner.
+func (v *Viz) AddRecords(name string, total int64) *Records {
+	rs := &recordStatus{total: total, clock: newClock()}
+	v.add(readInfo{Name: name, View: rs})
+	return &Records{rs: rs}
+}
+
+// Inc counts one more record.
+func (r *Records) Inc() {
+	atomic.AddInt64(&r.rs.n, 1)
+}
+
+// Set sets the number of records processed so far.
+func (r *Records) Set(n int64) {
+	atomic.StoreInt64(&r.rs.n, n)
+}
+
+//////////
+
+// recordStatus shows a record count, e.g. "0:12 3,402/10,000 (34.02%)".
+type recordStatus struct {
+	n     int64 // accessed atomically
+	total int64
+	wheel
+	statusBuf
+	clock
+	elapsed time.Duration
+}
+
+func (s *recordStatus) ReadStatus() string {
+	n := atomic.LoadInt64(&s.n)
+	d := s.elapsed
+	if d == 0 {
+		d = s.sinceStart()
+	}
+	b := append(s.buf[:0], s.duration(d)...)
+	b = append(b, ' ')
+	b = appendCount(b, n)
+	if s.total > 0 {
+		b = append(b, '/')
+		b = appendCount(b, s.total)
+		b = append(b, " ("...)
+		b = strconv.AppendFloat(b, s.percent(), 'f', 2, 64)
+		b = append(b, "%)"...)
+	} else if s.elapsed == 0 {
+		b = append(b, ' ')
+		b = utf8.AppendRune(b, s.next())
+	}
+	s.buf = b
+	return string(b)
+}
+
+func (s *recordStatus) Done() {
+	if s.elapsed != 0 {
+		return
+	}
+	s.elapsed = s.sinceStart()
+	if s.elapsed == 0 {
+		s.elapsed = time.Second
+	}
+}
+
+func (s *recordStatus) percent() float64 {
+	if s.elapsed != 0 {
+		return 100.0
+	}
+	if s.total <= 0 {
+		return 0
+	}
+	pct := 100.0 * float64(atomic.LoadInt64(&s.n)) / float64(s.total)
+	if pct > 100.0 {
+		return 100.0
+	}
+	return pct
+}
+
+func (s *recordStatus) elapsedTime() time.Duration {
+	if s.elapsed != 0 {
+		return s.elapsed
+	}
+	return s.sinceStart()
+}
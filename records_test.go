@@ -0,0 +1,47 @@
+package parprog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAddRecords(t *testing.T) {
+	clk := newFakeClock()
+	v := newTestViz(clk)
+	r := v.AddRecords("data.csv", 10000)
+	clk.advance(12 * time.Second)
+
+	tests := []struct {
+		update func()
+		want   string
+	}{
+		{func() {}, "0:12 0/10,000 (0.00%)"},
+		{r.Inc, "0:12 1/10,000 (0.01%)"},
+		{func() { r.Set(3402) }, "0:12 3,402/10,000 (34.02%)"},
+		{r.Inc, "0:12 3,403/10,000 (34.03%)"},
+		{func() { r.Set(20000) }, "0:12 20,000/10,000 (100.00%)"},
+	}
+	for _, tt := range tests {
+		tt.update()
+		if got := statusOf(v, "data.csv"); got != tt.want {
+			t.Errorf("status = %q, want %q", got, tt.want)
+		}
+	}
+	v.Complete("data.csv", nil)
+	if got := statusOf(v, "data.csv"); got != "0:12 20,000/10,000 (100.00%)" {
+		t.Errorf("completed status = %q", got)
+	}
+}
+
+func TestAddRecordsUnknownTotal(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	r := v.AddRecords("stream", 0)
+	r.Set(1234567)
+	if got := statusOf(v, "stream"); got != "0:00 1,234,567 -" {
+		t.Errorf("status = %q, want the count and a spinner", got)
+	}
+	v.Complete("stream", nil)
+	if got := statusOf(v, "stream"); got != "0:01 1,234,567" {
+		t.Errorf("completed status = %q, want no spinner", got)
+	}
+}
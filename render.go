@@ -0,0 +1,255 @@
+package parprog
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nsf/termbox-go"
+	"golang.org/x/term"
+)
+
+// renderer is the drawing surface the display is drawn onto. The default
+// draws to the terminal with termbox, but an in-memory surface can be used to
+// capture frames without a terminal.
+type renderer interface {
+	SetCell(x, y int, ch rune, fg, bg termbox.Attribute)
+	Clear(fg, bg termbox.Attribute) error
+	Flush() error
+	Size() (width, height int)
+}
+
+// termboxRenderer draws using the global termbox state.
+type termboxRenderer struct{}
+
+func (termboxRenderer) SetCell(x, y int, ch rune, fg, bg termbox.Attribute) {
+	termbox.SetCell(x, y, ch, fg, bg)
+}
+
+func (termboxRenderer) Clear(fg, bg termbox.Attribute) error { return termbox.Clear(fg, bg) }
+func (termboxRenderer) Flush() error                         { return termbox.Flush() }
+func (termboxRenderer) Size() (int, int)                     { return termbox.Size() }
+
+// memRenderer is an in-memory renderer of a fixed size.
+type memRenderer struct {
+	w, h  int
+	cells []termbox.Cell
+}
+
+func newMemRenderer(w, h int) *memRenderer {
+	m := &memRenderer{w: w, h: h, cells: make([]termbox.Cell, w*h)}
+	m.Clear(termbox.ColorDefault, termbox.ColorDefault)
+	return m
+}
+
+func (m *memRenderer) SetCell(x, y int, ch rune, fg, bg termbox.Attribute) {
+	if x < 0 || y < 0 || x >= m.w || y >= m.h {
+		return
+	}
+	m.cells[y*m.w+x] = termbox.Cell{Ch: ch, Fg: fg, Bg: bg}
+}
+
+func (m *memRenderer) Clear(fg, bg termbox.Attribute) error {
+	for i := range m.cells {
+		m.cells[i] = termbox.Cell{Ch: ' ', Fg: fg, Bg: bg}
+	}
+	return nil
+}
+
+func (m *memRenderer) Flush() error     { return nil }
+func (m *memRenderer) Size() (int, int) { return m.w, m.h }
+
+// Cell returns the cell drawn at x, y.
+func (m *memRenderer) Cell(x, y int) termbox.Cell {
+	return m.cells[y*m.w+x]
+}
+
+// String returns the characters drawn, one line per row with trailing spaces
+// removed.
+func (m *memRenderer) String() string {
+	var sb strings.Builder
+	for y := 0; y < m.h; y++ {
+		row := make([]rune, m.w)
+		for x := range row {
+			row[x] = m.cells[y*m.w+x].Ch
+		}
+		sb.WriteString(strings.TrimRight(string(row), " "))
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+//////////
+
+// ansiRenderer draws a block of lines in place below any existing output,
+// using cursor-up and clear-line escape sequences instead of taking over the
+// screen. Only rows up to the last non-blank one are written.
+type ansiRenderer struct {
+	w       io.Writer
+	fd      int // terminal queried for the size, or -1 if w is not one
+	cols    int
+	rows    int
+	cells   []termbox.Cell
+	buf     []byte
+	written int // lines written by the last Flush
+
+	// terminal title, written by Flush when it has changed
+	title      string
+	shownTitle string
+}
+
+func newANSIRenderer(w io.Writer) *ansiRenderer {
+	a := &ansiRenderer{w: w, fd: -1}
+	if f, ok := w.(*os.File); ok && isTerminal(f) {
+		a.fd = int(f.Fd())
+	}
+	a.resize()
+	return a
+}
+
+// termSize returns the size of the terminal fd. It is replaced in tests.
+var termSize = term.GetSize
+
+// resize fits the cells to the current size of the terminal, or to $COLUMNS
+// and $LINES if it cannot be queried.
+func (a *ansiRenderer) resize() {
+	cols, rows := 0, 0
+	if a.fd >= 0 {
+		cols, rows, _ = termSize(a.fd)
+	}
+	if cols < 2 || rows < 2 {
+		cols, rows = envSize("COLUMNS", 80), envSize("LINES", 24)
+	}
+	// stay one column short of the edge so lines never wrap (which would throw
+	// off the cursor movement), and one row short so the block never scrolls
+	// off the top of the screen.
+	cols, rows = cols-1, rows-1
+	if cols == a.cols && rows == a.rows {
+		return
+	}
+	a.cols, a.rows = cols, rows
+	a.cells = make([]termbox.Cell, cols*rows)
+	a.Clear(termbox.ColorDefault, termbox.ColorDefault)
+}
+
+// envSize returns the terminal dimension from the named environment variable,
+// or def if it is unset or too small to be usable.
+func envSize(name string, def int) int {
+	n, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || n < 2 {
+		return def
+	}
+	return n
+}
+
+func (a *ansiRenderer) SetCell(x, y int, ch rune, fg, bg termbox.Attribute) {
+	if x < 0 || y < 0 || x >= a.cols || y >= a.rows {
+		return
+	}
+	a.cells[y*a.cols+x] = termbox.Cell{Ch: ch, Fg: fg, Bg: bg}
+}
+
+func (a *ansiRenderer) Clear(fg, bg termbox.Attribute) error {
+	for i := range a.cells {
+		a.cells[i] = termbox.Cell{Ch: ' ', Fg: fg, Bg: bg}
+	}
+	return nil
+}
+
+// Size re-queries the terminal, so that the display is redrawn to fit after it
+// is resized.
+func (a *ansiRenderer) Size() (int, int) {
+	a.resize()
+	return a.cols, a.rows
+}
+
+func (a *ansiRenderer) Flush() error {
+	n := 0
+	for y := 0; y < a.rows; y++ {
+		for _, c := range a.cells[y*a.cols : (y+1)*a.cols] {
+			if c.Ch != ' ' {
+				n = y + 1
+				break
+			}
+		}
+	}
+
+	b := a.buf[:0]
+	if a.title != a.shownTitle {
+		b = append(b, "\x1b]0;"...)
+		b = append(b, a.title...)
+		b = append(b, '\a')
+		a.shownTitle = a.title
+	}
+	if a.written > 0 {
+		b = append(b, "\x1b["...)
+		b = strconv.AppendInt(b, int64(a.written), 10)
+		b = append(b, 'A')
+	}
+	for y := 0; y < n; y++ {
+		row := a.cells[y*a.cols : (y+1)*a.cols]
+		end := len(row)
+		for end > 0 && row[end-1].Ch == ' ' {
+			end--
+		}
+		b = append(b, "\r\x1b[2K"...)
+		fg := termbox.ColorDefault
+		for _, c := range row[:end] {
+			if c.Fg != fg {
+				b = appendSGR(b, c.Fg)
+				fg = c.Fg
+			}
+			b = utf8.AppendRune(b, c.Ch)
+		}
+		if fg != termbox.ColorDefault {
+			b = append(b, "\x1b[0m"...)
+		}
+		b = append(b, '\n')
+	}
+	if n < a.written {
+		// clear the leftover lines of a taller previous block
+		b = append(b, "\r\x1b[J"...)
+	}
+	a.buf = b
+	a.written = n
+	_, err := a.w.Write(b)
+	return err
+}
+
+// release forgets the lines already drawn, so that the next Flush starts a
+// new block below them instead of overwriting them.
+func (a *ansiRenderer) release() {
+	a.written = 0
+}
+
+// clearTitle blanks the terminal title if one was written, without drawing
+// the cells, e.g. when stopping while paused.
+func (a *ansiRenderer) clearTitle() {
+	a.title = ""
+	if a.shownTitle != "" {
+		io.WriteString(a.w, "\x1b]0;\a")
+		a.shownTitle = ""
+	}
+}
+
+// appendSGR appends the escape sequence selecting the color and attributes of
+// fg.
+func appendSGR(b []byte, fg termbox.Attribute) []byte {
+	b = append(b, "\x1b[0"...)
+	if c := fg & 0xff; c >= termbox.ColorBlack && c <= termbox.ColorWhite {
+		b = append(b, ';')
+		b = strconv.AppendInt(b, int64(30+c-termbox.ColorBlack), 10)
+	}
+	if fg&termbox.AttrBold != 0 {
+		b = append(b, ";1"...)
+	}
+	if fg&termbox.AttrUnderline != 0 {
+		b = append(b, ";4"...)
+	}
+	if fg&termbox.AttrReverse != 0 {
+		b = append(b, ";7"...)
+	}
+	return append(b, 'm')
+}
@@ -0,0 +1,161 @@
+package parprog
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nsf/termbox-go"
+)
+
+// cellRow returns the characters of row y of m, read cell by cell.
+func cellRow(m *memRenderer, y int) string {
+	rs := make([]rune, m.w)
+	for x := range rs {
+		rs[x] = m.Cell(x, y).Ch
+	}
+	return string(rs)
+}
+
+func TestMemRenderer(t *testing.T) {
+	clk := newFakeClock()
+	v := newTestViz(clk)
+	m := newMemRenderer(24, 4)
+	v.render = m
+	v.Add("a", nil)
+	v.Complete("a", nil)
+	clk.advance(2 * time.Second)
+
+	redraw := func() {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		if err := v.redrawLocked(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	redraw()
+	want := []string{
+		"Elapsed 0:02, 1/1 done, ",
+		"0:01 100.00% a          ",
+		"                        ",
+		"                        ",
+	}
+	for y, w := range want {
+		if got := cellRow(m, y); got != w {
+			t.Errorf("row %d = %q, want %q", y, got, w)
+		}
+	}
+
+	// only the changed cells are redrawn, leaving the rest as they were
+	m.SetCell(23, 3, 'x', termbox.ColorRed, termbox.ColorDefault)
+	m.SetCell(24, 3, 'y', termbox.ColorRed, termbox.ColorDefault) // off screen
+	clk.advance(time.Second)
+	redraw()
+	if got := cellRow(m, 0); got != "Elapsed 0:03, 1/1 done, " {
+		t.Errorf("header = %q after a second", got)
+	}
+	if c := m.Cell(23, 3); c.Ch != 'x' || c.Fg != termbox.ColorRed {
+		t.Errorf("unchanged cell redrawn as %+v", c)
+	}
+}
+
+func TestANSIFlush(t *testing.T) {
+	var buf bytes.Buffer
+	t.Setenv("COLUMNS", "11")
+	t.Setenv("LINES", "5")
+	a := newANSIRenderer(&buf)
+	if w, h := a.Size(); w != 10 || h != 4 {
+		t.Fatalf("size %dx%d, want 10x4 from the environment", w, h)
+	}
+
+	drawString := func(y int, s string, fg termbox.Attribute) {
+		for x, ch := range []rune(s) {
+			a.SetCell(x, y, ch, fg, termbox.ColorDefault)
+		}
+	}
+	drawString(0, "header", termbox.ColorDefault)
+	drawString(1, "too long to fit", termbox.ColorRed|termbox.AttrBold)
+	a.Flush()
+	want := "\r\x1b[2Kheader\n" +
+		"\r\x1b[2K\x1b[0;31;1mtoo long t\x1b[0m\n"
+	if got := buf.String(); got != want {
+		t.Errorf("first flush wrote %q, want %q", got, want)
+	}
+
+	// the next block overwrites the previous one, clearing what is left
+	buf.Reset()
+	a.Clear(termbox.ColorDefault, termbox.ColorDefault)
+	drawString(0, "done", termbox.ColorDefault)
+	a.Flush()
+	want = "\x1b[2A\r\x1b[2Kdone\n\r\x1b[J"
+	if got := buf.String(); got != want {
+		t.Errorf("second flush wrote %q, want %q", got, want)
+	}
+}
+
+func TestANSISize(t *testing.T) {
+	defer func(fn func(int) (int, int, error)) { termSize = fn }(termSize)
+	cols, rows := 100, 30
+	termSize = func(fd int) (int, int, error) {
+		if cols == 0 {
+			return 0, 0, errors.New("not a terminal")
+		}
+		return cols, rows, nil
+	}
+	t.Setenv("COLUMNS", "41")
+	t.Setenv("LINES", "11")
+
+	a := &ansiRenderer{w: io.Discard, fd: 1}
+	a.resize()
+	if w, h := a.Size(); w != 99 || h != 29 {
+		t.Errorf("size %dx%d, want 99x29 from the terminal", w, h)
+	}
+	cols, rows = 60, 10
+	if w, h := a.Size(); w != 59 || h != 9 || len(a.cells) != 59*9 {
+		t.Errorf("size %dx%d with %d cells after resizing, want 59x9", w, h, len(a.cells))
+	}
+	cols = 0
+	if w, h := a.Size(); w != 40 || h != 10 {
+		t.Errorf("size %dx%d, want 40x10 from the environment", w, h)
+	}
+}
+
+func TestStartANSIOutput(t *testing.T) {
+	var buf syncBuffer
+	v := &Viz{}
+	v.Output(&buf)
+	v.Add("reader", nil)
+	v.StartANSI(time.Hour)
+	v.Stop()
+	got := buf.String()
+	if !strings.Contains(got, "\r\x1b[2K") || !strings.Contains(got, "reader\n") {
+		t.Errorf("output = %q, want the display drawn with escape sequences", got)
+	}
+}
+
+func TestTitleProgress(t *testing.T) {
+	for _, paused := range []bool{false, true} {
+		var buf syncBuffer
+		v := &Viz{}
+		v.Output(&buf)
+		v.SetTitleProgress(true)
+		v.StartANSI(time.Hour)
+		v.Add("a", nil)
+		v.Add("b", nil)
+		v.Complete("a", nil)
+		title := "\x1b]0;parprog 50% (1/2)\a"
+		waitFor(t, "the title", func() bool { return strings.Contains(buf.String(), title) })
+		if paused {
+			v.Pause()
+		}
+		v.Stop()
+
+		got := buf.String()
+		if i := strings.Index(got, title); i < 0 || !strings.Contains(got[i:], "\x1b]0;\a") {
+			t.Errorf("paused=%v: output = %q, want the title set then cleared", paused, got)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package parprog
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ReaderStatus is a point-in-time copy of a reader's progress.
+type ReaderStatus struct {
+	Name    string
+	Percent float64 // 0 if unknown
+	Elapsed time.Duration
+	Done    bool
+	Err     error
+
+	Completed time.Time // when Complete was called, zero until then
+
+	// byte rates in bytes/sec, for readers which count bytes
+	PeakRate float64 // highest rate seen between two refreshes
+	MinRate  float64 // lowest rate seen between two refreshes, e.g. 0 if stalled
+	AvgRate  float64 // bytes processed over the elapsed time
+}
+
+// Snapshot returns the current status of every reader, in the order they were
+// added. It is safe to call from any goroutine.
+func (v *Viz) Snapshot() []ReaderStatus {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	res := make([]ReaderStatus, len(v.readers))
+	for i, r := range v.readers {
+		res[i] = ReaderStatus{
+			Name:    r.Name,
+			Percent: percentOf(r),
+			Elapsed: r.View.elapsedTime(),
+			Done:    r.Done,
+			Err:     r.Error,
+
+			Completed: r.Completed,
+		}
+		if ss, ok := r.View.(sizedStatus); ok {
+			res[i].PeakRate = ss.progress().peak
+			res[i].MinRate = ss.progress().low
+		}
+		if bc, ok := r.View.(byteCount); ok && res[i].Elapsed > 0 {
+			res[i].AvgRate = float64(bc.bytesDone()) / res[i].Elapsed.Seconds()
+		}
+	}
+	return res
+}
+
+// byteCount is implemented by statuses which know how many bytes have been
+// processed.
+type byteCount interface {
+	bytesDone() int64
+}
+
+func (c *byteCounter) bytesDone() int64 {
+	return atomic.LoadInt64(&c.n)
+}
+
+func (w *fileWrapper) bytesDone() int64 {
+	return w.position()
+}
+
+// TotalBytes returns the number of bytes processed so far across all readers
+// and writers which count bytes (i.e. everything except spinners and custom
+// statuses). Removed readers are not included. It is safe to call from any
+// goroutine, during or after the run.
+func (v *Viz) TotalBytes() int64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.totalBytesLocked()
+}
+
+func (v *Viz) totalBytesLocked() int64 {
+	var total int64
+	for _, r := range v.readers {
+		if bc, ok := r.View.(byteCount); ok {
+			total += bc.bytesDone()
+		}
+	}
+	return total
+}
+
+// RunStats summarizes a run, e.g. for structured logging after Stop.
+type RunStats struct {
+	Readers   int              // readers not removed
+	Succeeded int              // completed without an error
+	Failed    int              // completed with an error
+	Errors    map[string]error // errors of the failed readers, by name
+	Bytes     int64            // as in TotalBytes
+	Duration  time.Duration    // wall-clock time from Start until Stop, or now
+	Peak      int              // most readers active at once
+}
+
+// Stats returns a summary of the run so far. Readers which were Removed are
+// not included, except in Peak.
+func (v *Viz) Stats() RunStats {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	st := RunStats{
+		Readers: len(v.readers),
+		Bytes:   v.totalBytesLocked(),
+		Peak:    v.peak,
+	}
+	for _, r := range v.readers {
+		switch {
+		case !r.Done:
+		case r.Error != nil:
+			st.Failed++
+			if st.Errors == nil {
+				st.Errors = make(map[string]error)
+			}
+			st.Errors[r.Name] = r.Error
+		default:
+			st.Succeeded++
+		}
+	}
+	if !v.started.IsZero() {
+		end := v.stopped
+		if end.IsZero() {
+			end = v.now()
+		}
+		st.Duration = end.Sub(v.started)
+	}
+	return st
+}
+
+// DurationBucket counts the completed readers whose elapsed time was at most
+// Max, and more than the Max of the bucket before it.
+type DurationBucket struct {
+	Label string        // e.g. "5-30s"
+	Max   time.Duration // 0 for the last bucket, which has no upper bound
+	Count int
+}
+
+// durationBounds are the upper bounds of all but the last DurationHistogram
+// bucket. Elapsed times are in whole seconds, with anything quicker counted
+// as 1s, so the bounds are inclusive.
+var durationBounds = []struct {
+	label string
+	max   time.Duration
+}{
+	{"<=1s", time.Second},
+	{"1-5s", 5 * time.Second},
+	{"5-30s", 30 * time.Second},
+	{"30s-2m", 2 * time.Minute},
+}
+
+// DurationHistogram returns the distribution of the elapsed times of the
+// completed readers, in buckets of <=1s, 1-5s, 5-30s, 30s-2m and >2m, e.g. to
+// spot a few slow outliers after a run. Readers which are still running or
+// were Removed are not included.
+func (v *Viz) DurationHistogram() []DurationBucket {
+	res := make([]DurationBucket, len(durationBounds)+1)
+	for i, b := range durationBounds {
+		res[i] = DurationBucket{Label: b.label, Max: b.max}
+	}
+	res[len(durationBounds)].Label = ">2m"
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for _, r := range v.readers {
+		if !r.Done {
+			continue
+		}
+		i := 0
+		for i < len(durationBounds) && r.View.elapsedTime() > durationBounds[i].max {
+			i++
+		}
+		res[i].Count++
+	}
+	return res
+}
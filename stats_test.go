@@ -0,0 +1,206 @@
+package parprog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	clk := newFakeClock()
+	v := newTestViz(clk)
+	errBad := errors.New("bad")
+	v.Add("a", nil)
+	v.SetProgress("a", 0.5)
+	v.Add("b", nil)
+	clk.advance(3 * time.Second)
+	v.Complete("b", errBad)
+	clk.advance(time.Second)
+
+	snap := v.Snapshot()
+	want := []ReaderStatus{
+		{Name: "a", Percent: 50, Elapsed: 4 * time.Second},
+		{Name: "b", Percent: 100, Elapsed: 3 * time.Second, Done: true, Err: errBad, Completed: clk.now().Add(-time.Second)},
+	}
+	if len(snap) != len(want) {
+		t.Fatalf("snapshot has %d readers, want %d", len(snap), len(want))
+	}
+	for i := range want {
+		if snap[i] != want[i] {
+			t.Errorf("snapshot[%d] = %+v, want %+v", i, snap[i], want[i])
+		}
+	}
+
+	// the snapshot is a copy
+	snap[0].Name = "changed"
+	if got := v.Snapshot()[0].Name; got != "a" {
+		t.Errorf("changing the snapshot renamed the reader to %q", got)
+	}
+}
+
+func TestTotalBytes(t *testing.T) {
+	v := &Viz{}
+	if n := v.TotalBytes(); n != 0 {
+		t.Errorf("TotalBytes = %d before any readers", n)
+	}
+	a := v.AddCounting("a", strings.NewReader(strings.Repeat("x", 100)))
+	b := v.AddSized("b", strings.NewReader(strings.Repeat("x", 1000)), 1000)
+	w := v.AddWriter("c", io.Discard, 50)
+	v.Add("spinner", nil)
+
+	io.Copy(io.Discard, a)
+	io.CopyN(io.Discard, b, 300)
+	w.Write(make([]byte, 50))
+	if n := v.TotalBytes(); n != 450 {
+		t.Errorf("TotalBytes = %d, want 450", n)
+	}
+	v.Complete("a", nil)
+	if n := v.TotalBytes(); n != 450 {
+		t.Errorf("TotalBytes = %d after completing a, want 450", n)
+	}
+	v.Remove("b")
+	if n := v.TotalBytes(); n != 150 {
+		t.Errorf("TotalBytes = %d after removing b, want 150", n)
+	}
+}
+
+func TestStats(t *testing.T) {
+	clk := newFakeClock()
+	v := &Viz{}
+	v.setClock(clk.now)
+	v.StartWriter(io.Discard, time.Hour)
+	errBad := errors.New("bad")
+	r := v.AddSized("a", strings.NewReader(strings.Repeat("x", 100)), 100)
+	v.Add("b", nil)
+	v.Add("c", nil)
+	v.Add("removed", nil)
+	io.Copy(io.Discard, r)
+	v.Remove("removed")
+	v.Complete("a", nil)
+	v.Complete("b", errBad)
+	v.Add("d", nil)
+	clk.advance(90 * time.Second)
+	v.Stop()
+	clk.advance(time.Hour)
+
+	st := v.Stats()
+	want := RunStats{
+		Readers:   4,
+		Succeeded: 1,
+		Failed:    1,
+		Errors:    map[string]error{"b": errBad},
+		Bytes:     100,
+		Duration:  90 * time.Second,
+		Peak:      4,
+	}
+	if !reflect.DeepEqual(st, want) {
+		t.Errorf("Stats = %+v, want %+v", st, want)
+	}
+}
+
+func TestCompleteTwice(t *testing.T) {
+	clk := newFakeClock()
+	v := newTestViz(clk)
+	f := sizedFile(t, 100)
+	v.Add("file", f)
+	v.Add("spinner", nil)
+	clk.advance(3 * time.Second)
+	first := clk.now()
+	errFirst := errors.New("first")
+	v.Complete("file", errFirst)
+	v.Complete("spinner", nil)
+
+	clk.advance(time.Minute)
+	v.Complete("file", errors.New("second"))
+	v.Complete("spinner", errors.New("second"))
+	for _, st := range v.Snapshot() {
+		if st.Elapsed != 3*time.Second || !st.Completed.Equal(first) {
+			t.Errorf("%s: elapsed %v, completed %v, want the first completion to stand", st.Name, st.Elapsed, st.Completed)
+		}
+	}
+	if err, _ := v.Error("file"); err != errFirst {
+		t.Errorf("file error = %v, want the first", err)
+	}
+	if err, _ := v.Error("spinner"); err != nil {
+		t.Errorf("spinner error = %v, want nil from the first", err)
+	}
+}
+
+func TestRates(t *testing.T) {
+	clk := newFakeClock()
+	v := newTestViz(clk)
+	r := v.AddCounting("data", strings.NewReader(strings.Repeat("x", 10000)))
+	steady := v.AddSized("steady", strings.NewReader(strings.Repeat("x", 10000)), 10000)
+
+	// bytes read before each refresh, one second apart
+	for i, n := range []int64{1000, 3000, 0, 2000} {
+		statusOf(v, "data")
+		statusOf(v, "steady")
+		clk.advance(time.Second)
+		io.CopyN(io.Discard, r, n)
+		io.CopyN(io.Discard, steady, 1000*int64(i+1))
+	}
+	statusOf(v, "data")
+	statusOf(v, "steady")
+	v.Complete("data", nil)
+	v.Complete("steady", nil)
+
+	st := v.Snapshot()
+	if st[0].PeakRate != 3000 || st[0].MinRate != 0 {
+		t.Errorf("rates = %v to %v, want 0 to 3000", st[0].MinRate, st[0].PeakRate)
+	}
+	if st[0].Elapsed != 4*time.Second || st[0].AvgRate != 1500 {
+		t.Errorf("AvgRate = %v over %v, want 1500 over 4s", st[0].AvgRate, st[0].Elapsed)
+	}
+	if st[1].PeakRate != 4000 || st[1].MinRate != 1000 || st[1].AvgRate != 2500 {
+		t.Errorf("steady rates = %v to %v averaging %v, want 1000 to 4000 averaging 2500",
+			st[1].MinRate, st[1].PeakRate, st[1].AvgRate)
+	}
+}
+
+func TestDurationHistogram(t *testing.T) {
+	clk := newFakeClock()
+	v := newTestViz(clk)
+	// elapsed times on the bucket boundaries fall in the lower bucket
+	elapsed := []time.Duration{
+		0, // shown as 1s
+		time.Second,
+		3 * time.Second,
+		5 * time.Second,
+		6 * time.Second,
+		30 * time.Second,
+		90 * time.Second,
+		2 * time.Minute,
+		2*time.Minute + time.Second,
+		10 * time.Minute,
+	}
+	for i := range elapsed {
+		v.Add(fmt.Sprint("done", i), nil)
+	}
+	v.Add("running", nil)
+	v.Add("removed", nil)
+	var now time.Duration
+	for i, d := range elapsed {
+		clk.advance(d - now)
+		now = d
+		v.Complete(fmt.Sprint("done", i), nil)
+	}
+	v.Complete("removed", nil)
+	v.Remove("removed")
+
+	got := v.DurationHistogram()
+	want := []DurationBucket{
+		{"<=1s", time.Second, 2},
+		{"1-5s", 5 * time.Second, 2},
+		{"5-30s", 30 * time.Second, 2},
+		{"30s-2m", 2 * time.Minute, 2},
+		{">2m", 0, 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("histogram = %+v, want %+v", got, want)
+	}
+}
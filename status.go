@@ -1,92 +1,420 @@
 package parprog
 
 import (
-	"fmt"
+	"io"
 	"os"
 	"time"
+	"unicode/utf8"
 )
 
 const Wheel = "/-\\|"
 
+// Spinner frame presets for use with Viz.SpinnerStyle.
+var (
+	SpinnerLine  = []rune(Wheel)
+	SpinnerDots  = []rune("⠋⠙⠹⠸⠼⠴⠦⠧⠇⠏")
+	SpinnerArrow = []rune("←↖↑↗→↘↓↙")
+	SpinnerASCII = []rune(".oOo")
+)
+
+// rateSmoothing is the weight given to the newest sample in the exponential
+// moving average of byte rates.
+const rateSmoothing = 0.3
+
+// minRateInterval is the shortest time the byte rate is measured over, so
+// that extra redraws between refreshes do not skew it.
+const minRateInterval = 100 * time.Millisecond
+
+// StatusRenderer is implemented by status displays for a reader. Custom
+// implementations can be added with Viz.AddCustom, e.g. to show records/sec
+// for a parser, while reusing the Viz display loop.
+type StatusRenderer interface {
+	// ReadStatus returns the status text to display. It is called from the
+	// display goroutine on every refresh until Done is called.
+	ReadStatus() string
+	// Done is called when the reader is completed.
+	Done()
+}
+
 type readStatusInterface interface {
-	readStatus() string
-	done()
+	StatusRenderer
+
+	// percent returns the percent complete, or 0 if unknown.
+	percent() float64
+	// elapsedTime returns the time taken so far, or in total once done.
+	elapsedTime() time.Duration
+}
+
+// sizedStatus is implemented by statuses tracking progress against a known
+// size, so the display can compute ETAs and draw bars.
+type sizedStatus interface {
+	progress() *byteProgress
 }
 
 ///////////////////
 
+// wheel cycles through spinner frames, defaulting to Wheel.
+type wheel struct {
+	frames []rune
+	w      int
+}
+
+func (wh *wheel) setFrames(frames []rune) {
+	wh.frames = frames
+}
+
+func (wh *wheel) next() rune {
+	if len(wh.frames) == 0 {
+		wh.frames = SpinnerLine
+	}
+	wh.w = (wh.w + 1) % len(wh.frames)
+	return wh.frames[wh.w]
+}
+
+// statusBuf reuses a byte buffer and caches the formatted elapsed time (which
+// only changes once a second), so that building a status string on every
+// refresh allocates as little as possible.
+type statusBuf struct {
+	buf  []byte
+	durD time.Duration
+	durS string
+}
+
+func (sb *statusBuf) duration(d time.Duration) string {
+	if sb.durS == "" || d != sb.durD {
+		sb.durD, sb.durS = d, formatDuration(d)
+	}
+	return sb.durS
+}
+
+// finalStatus returns the status of a completed reader, e.g. "0:03 100.00%".
+func (sb *statusBuf) finalStatus(elapsed time.Duration) string {
+	b := append(sb.buf[:0], sb.duration(elapsed)...)
+	b = append(b, " 100.00%"...)
+	sb.buf = b
+	return string(b)
+}
+
+// clock tracks when a status started, from a replaceable source of the current
+// time so that elapsed times can be faked in tests.
+type clock struct {
+	nowFunc func() time.Time // nil for time.Now
+	start   time.Time
+}
+
+func newClock() clock {
+	return clock{start: time.Now().Truncate(time.Second)}
+}
+
+func (c *clock) now() time.Time {
+	if c.nowFunc == nil {
+		return time.Now()
+	}
+	return c.nowFunc()
+}
+
+// setClock replaces the source of the current time, restarting the clock.
+func (c *clock) setClock(now func() time.Time) {
+	c.nowFunc = now
+	c.start = c.now().Truncate(time.Second)
+}
+
+// sinceStart returns the time since the clock started, in whole seconds.
+func (c *clock) sinceStart() time.Duration {
+	return c.now().Truncate(time.Second).Sub(c.start)
+}
+
 // spinner spins a wheel each time status is updated...
 type spinner struct {
-	w       int
-	start   time.Time
+	wheel
+	statusBuf
+	clock
 	elapsed time.Duration
+	shown   bool // the wheel only starts turning after the first refresh
+
+	// set by setProgress, when the caller knows how far along it is
+	determinate bool
+	frac        float64
 }
 
 func newSpinner() *spinner {
 	return &spinner{
-		start: time.Now().Truncate(time.Second),
+		clock: newClock(),
 	}
 }
 
-func (s *spinner) readStatus() string {
+func (s *spinner) ReadStatus() string {
 	if s.elapsed != 0 {
-		return fmt.Sprintf("%s %6.2f%%", s.elapsed.String(), 100.0)
+		return s.finalStatus(s.elapsed)
 	}
-	s.w = (s.w + 1) % len(Wheel)
-	return fmt.Sprintf("%s    %c   ",
-		time.Now().Truncate(time.Second).Sub(s.start).String(),
-		Wheel[s.w])
+	b := append(s.buf[:0], s.duration(s.sinceStart())...)
+	if s.determinate {
+		b = append(b, ' ')
+		b = appendPercent(b, 100.0*s.frac)
+		s.buf = b
+		return string(b)
+	}
+	b = append(b, "    "...)
+	if s.shown {
+		b = utf8.AppendRune(b, s.next())
+	} else {
+		// tasks finishing within a refresh never show a spinning frame
+		b = append(b, ' ')
+		s.shown = true
+	}
+	b = append(b, "   "...)
+	s.buf = b
+	return string(b)
 }
 
-func (s *spinner) done() {
-	s.elapsed = time.Now().Truncate(time.Second).Sub(s.start)
+func (s *spinner) Done() {
+	if s.elapsed != 0 {
+		return
+	}
+	s.elapsed = s.sinceStart()
 	if s.elapsed == 0 {
 		s.elapsed = time.Second
 	}
 }
 
+func (s *spinner) percent() float64 {
+	if s.elapsed != 0 {
+		return 100.0
+	}
+	return 100.0 * s.frac
+}
+
+// setProgress replaces the wheel with a percentage, from a fraction in the
+// range [0, 1].
+func (s *spinner) setProgress(frac float64) {
+	if frac < 0 {
+		frac = 0
+	} else if frac > 1 {
+		frac = 1
+	}
+	s.determinate = true
+	s.frac = frac
+}
+
+func (s *spinner) elapsedTime() time.Duration {
+	if s.elapsed != 0 {
+		return s.elapsed
+	}
+	return s.sinceStart()
+}
+
 //////////
 
-// fileWrapper shows percent completion by comparing current file offset to size
-type fileWrapper struct {
-	sz      float64
-	f       *os.File
-	start   time.Time
+// byteProgress computes percent completion, a smoothed byte rate and an ETA
+// from successive byte offsets into a known total size.
+type byteProgress struct {
+	statusBuf
+	size int64
+	clock
 	elapsed time.Duration
 	eta     time.Time
+	pct     float64
+
+	// byte rate tracking between refreshes
+	lastPos  int64
+	lastTime time.Time
+	rate     float64
+	peak     float64 // highest rate between two samples
+	low      float64 // lowest rate between two samples, once rated is set
+	rated    bool
+	ratePos  int64 // sample the rate is next measured from
+	rateTime time.Time
+}
+
+func newByteProgress(size int64) byteProgress {
+	return byteProgress{
+		size:  size,
+		clock: newClock(),
+	}
+}
+
+// progress exposes the embedded byteProgress to the display code.
+func (p *byteProgress) progress() *byteProgress {
+	return p
+}
+
+func (p *byteProgress) Done() {
+	if p.elapsed != 0 {
+		return
+	}
+	p.elapsed = p.sinceStart()
+	if p.elapsed == 0 {
+		p.elapsed = time.Second
+	}
+	p.pct = 100.0
+}
+
+func (p *byteProgress) percent() float64 {
+	return p.pct
+}
+
+func (p *byteProgress) elapsedTime() time.Duration {
+	if p.elapsed != 0 {
+		return p.elapsed
+	}
+	return p.sinceStart()
+}
+
+// position returns the number of bytes processed as of the last sample,
+// clamped to the size.
+func (p *byteProgress) position() int64 {
+	if p.pct >= 100.0 || p.lastPos > p.size {
+		return p.size
+	}
+	if p.lastPos < 0 {
+		return 0
+	}
+	return p.lastPos
+}
+
+// sample records the current byte offset, updating the rate, percent and ETA.
+func (p *byteProgress) sample(pos int64) {
+	now := p.now()
+	if p.rateTime.IsZero() {
+		p.ratePos, p.rateTime = pos, now
+	} else if dt := now.Sub(p.rateTime); dt >= minRateInterval {
+		inst := float64(pos-p.ratePos) / dt.Seconds()
+		p.rate += rateSmoothing * (inst - p.rate)
+		if inst > p.peak {
+			p.peak = inst
+		}
+		if inst < p.low || !p.rated {
+			p.low, p.rated = inst, true
+		}
+		p.ratePos, p.rateTime = pos, now
+	}
+	p.lastPos, p.lastTime = pos, now
+
+	p.eta = time.Time{}
+	if p.size <= 0 {
+		return
+	}
+
+	// the file may have grown, or been seeked past the end
+	p.pct = 100.0 * float64(pos) / float64(p.size)
+	if p.pct > 100.0 {
+		p.pct = 100.0
+	} else if p.pct < 0 {
+		p.pct = 0
+	}
+	if p.rate > 0 {
+		remaining := time.Duration(float64(p.size-pos) / p.rate * float64(time.Second))
+		p.eta = now.Add(remaining)
+	}
 }
 
-func (w *fileWrapper) done() {
-	w.elapsed = time.Now().Truncate(time.Second).Sub(w.start)
+// update records the current byte offset and returns the status string.
+func (p *byteProgress) update(pos int64) string {
+	p.sample(pos)
+	totalElapsed := p.sinceStart()
+	b := append(p.buf[:0], p.duration(totalElapsed)...)
+	b = append(b, ' ')
+	b = appendPercent(b, p.pct)
+	b = append(b, ' ')
+	b = appendBytes(b, p.rate)
+	b = append(b, "/s ETA "...)
+	if p.eta.IsZero() {
+		b = append(b, "--"...)
+	} else {
+		b = appendDuration(b, p.eta.Sub(p.lastTime))
+	}
+	p.buf = b
+	return string(b)
 }
 
-func wrapFile(f *os.File) (*fileWrapper, error) {
+//////////
+
+// fileWrapper shows percent completion by comparing current file offset to
+// size. The offset is read with Seek from the display goroutine while the
+// caller reads f, see Add.
+type fileWrapper struct {
+	f *os.File
+	byteProgress
+}
+
+// wrapFile returns a status showing progress through f. Files which cannot be
+// seeked (pipes and devices) or which report a size of 0 cannot show a
+// percentage, so get a spinner instead: one fixed at 100% for an empty regular
+// file, which has nothing left to read. Files in /proc also report a size of 0
+// however much there is to read, so an empty file is only trusted if reading
+// its first byte finds the end.
+func wrapFile(f *os.File) (readStatusInterface, error) {
 	info, err := f.Stat()
 	if err != nil {
 		return nil, err
 	}
+	if _, err := f.Seek(0, io.SeekCurrent); err != nil {
+		// a pipe or device, which has no offset to show
+		return newSpinner(), nil
+	}
+	if info.Size() <= 0 {
+		s := newSpinner()
+		// ReadAt leaves the offset alone for the caller
+		if _, err := f.ReadAt(make([]byte, 1), 0); err == io.EOF && info.Mode().IsRegular() {
+			s.setProgress(1)
+		}
+		return s, nil
+	}
 	return &fileWrapper{
-		sz:    float64(info.Size()) / 100.0,
-		f:     f,
-		start: time.Now().Truncate(time.Second),
+		f:            f,
+		byteProgress: newByteProgress(info.Size()),
 	}, nil
 }
 
-func (w *fileWrapper) readStatus() string {
+func (w *fileWrapper) ReadStatus() string {
 	if w.elapsed != 0 {
-		return fmt.Sprintf("%s %6.2f%%", w.elapsed.String(), 100.0)
+		return w.finalStatus(w.elapsed)
 	}
-	pos, err := w.f.Seek(0, os.SEEK_CUR)
+	pos, err := w.f.Seek(0, io.SeekCurrent)
 	if err != nil {
-		w.elapsed = time.Now().Truncate(time.Second).Sub(w.start)
-		return fmt.Sprintf("%s %6.2f%%", w.elapsed.String(), 100.0)
+		// e.g. closed early, so stay where it was
+		pos = w.lastPos
+	}
+	return w.update(pos)
+}
+
+//////////
+
+// customStatus adapts a StatusRenderer supplied by the caller.
+type customStatus struct {
+	StatusRenderer
+	clock
+	elapsed time.Duration
+}
+
+func newCustomStatus(r StatusRenderer) *customStatus {
+	return &customStatus{
+		StatusRenderer: r,
+		clock:          newClock(),
 	}
+}
 
-	pct := float64(pos) / w.sz
-	totalElapsed := time.Now().Truncate(time.Second).Sub(w.start)
-	totalETA := time.Duration(totalElapsed.Seconds()/(pct/100.0)) * time.Second
-	w.eta = w.start.Add(totalETA)
-	remaining := totalETA - totalElapsed
+func (c *customStatus) Done() {
+	if c.elapsed != 0 {
+		return
+	}
+	c.elapsed = c.sinceStart()
+	if c.elapsed == 0 {
+		c.elapsed = time.Second
+	}
+	c.StatusRenderer.Done()
+}
+
+func (c *customStatus) percent() float64 {
+	if c.elapsed != 0 {
+		return 100.0
+	}
+	return 0
+}
 
-	return fmt.Sprintf("%s %6.2f%%", remaining.String(), pct)
+func (c *customStatus) elapsedTime() time.Duration {
+	if c.elapsed != 0 {
+		return c.elapsed
+	}
+	return c.sinceStart()
 }
@@ -0,0 +1,295 @@
+package parprog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sizedFile returns an open file of the given size in a temporary directory.
+func sizedFile(t *testing.T, size int64) *os.File {
+	t.Helper()
+	f, err := os.Create(filepath.Join(t.TempDir(), "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	if err := f.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// fileStatus wraps f, with elapsed times taken from clk.
+func fileStatus(t *testing.T, f *os.File, clk *fakeClock) *fileWrapper {
+	t.Helper()
+	view, err := wrapFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, ok := view.(*fileWrapper)
+	if !ok {
+		t.Fatalf("wrapFile returned a %T", view)
+	}
+	w.setClock(clk.now)
+	return w
+}
+
+func TestFileRate(t *testing.T) {
+	clk := newFakeClock()
+	f := sizedFile(t, 10<<20)
+	w := fileStatus(t, f, clk)
+	w.ReadStatus()
+
+	clk.advance(time.Second)
+	f.Seek(1<<20, io.SeekStart)
+	// the rate is smoothed, so only part of the first 1 MB/s sample counts
+	if st := w.ReadStatus(); !strings.Contains(st, " 307.2 KB/s ") {
+		t.Errorf("status = %q, want a rate of 307.2 KB/s", st)
+	}
+
+	clk.advance(time.Second)
+	if st := w.ReadStatus(); !strings.Contains(st, " 215.0 KB/s ") {
+		t.Errorf("stalled status = %q, want the rate to fall to 215.0 KB/s", st)
+	}
+}
+
+func TestCountingRate(t *testing.T) {
+	clk := newFakeClock()
+	cr := newCountingReader(strings.NewReader(strings.Repeat("x", 4096)), 0)
+	cr.setClock(clk.now)
+	cr.ReadStatus()
+
+	clk.advance(time.Second)
+	io.CopyN(io.Discard, cr, 2048)
+	if st := cr.ReadStatus(); !strings.Contains(st, " 2.0 KB 614 B/s ") {
+		t.Errorf("status = %q, want 2.0 KB read at 614 B/s", st)
+	}
+}
+
+func TestFileETA(t *testing.T) {
+	clk := newFakeClock()
+	f := sizedFile(t, 10<<20)
+	w := fileStatus(t, f, clk)
+	if st := w.ReadStatus(); !strings.HasSuffix(st, " ETA --") {
+		t.Errorf("status before any progress = %q, want ETA --", st)
+	}
+
+	clk.advance(time.Second)
+	f.Seek(1<<20, io.SeekStart)
+	// 9 MB left at a smoothed 0.3 MB/s
+	if st := w.ReadStatus(); !strings.HasSuffix(st, " ETA 0:30") {
+		t.Errorf("status = %q, want ETA 0:30", st)
+	}
+
+	// a single slow refresh only moves the estimate part of the way
+	clk.advance(time.Second)
+	f.Seek(1<<20+1<<18, io.SeekStart)
+	if st := w.ReadStatus(); !strings.HasSuffix(st, " ETA 0:31") {
+		t.Errorf("status after a slow refresh = %q, want ETA 0:31", st)
+	}
+}
+
+func TestFilePercentClamped(t *testing.T) {
+	f := sizedFile(t, 1000)
+	w := fileStatus(t, f, newFakeClock())
+
+	// the file grew after it was added
+	f.Truncate(2000)
+	f.Seek(1500, io.SeekStart)
+	if st := w.ReadStatus(); !strings.Contains(st, " 100.00% ") {
+		t.Errorf("status = %q, want 100.00%%", st)
+	}
+	if pct := w.percent(); pct != 100 {
+		t.Errorf("percent = %v, want 100", pct)
+	}
+	if pos := w.position(); pos != 1000 {
+		t.Errorf("position = %d, want it clamped to the size", pos)
+	}
+}
+
+func TestEmptyFile(t *testing.T) {
+	view, err := wrapFile(sizedFile(t, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := view.percent(); p != 100 {
+		t.Errorf("percent = %v for an empty file, want 100", p)
+	}
+	if st := view.ReadStatus(); !strings.Contains(st, "100.00%") {
+		t.Errorf("status = %q, want 100.00%%", st)
+	}
+}
+
+func TestProcFileSpinner(t *testing.T) {
+	// regular, with a size of 0, but not empty
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		t.Skip("no /proc")
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err != nil || info.Size() != 0 {
+		t.Skip("/proc reports a size")
+	}
+
+	view, err := wrapFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := view.percent(); p != 0 {
+		t.Errorf("percent = %v before reading, want 0", p)
+	}
+	if st := view.ReadStatus(); strings.Contains(st, "%") {
+		t.Errorf("status = %q, want a spinner rather than a percentage", st)
+	}
+	if pos, _ := f.Seek(0, io.SeekCurrent); pos != 0 {
+		t.Errorf("offset = %d after wrapping, want 0", pos)
+	}
+	view.Done()
+	if p := view.percent(); p != 100 {
+		t.Errorf("percent after Done = %v, want 100", p)
+	}
+}
+
+func TestPipeSpinner(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	v := newTestViz(newFakeClock())
+	v.Add("pipe", r)
+	if _, ok := v.readers[0].View.(*spinner); !ok {
+		t.Fatalf("a pipe shows a %T, want a spinner", v.readers[0].View)
+	}
+	if st := statusOf(v, "pipe"); strings.Contains(st, "%") {
+		t.Errorf("status = %q, want a spinner rather than a percentage", st)
+	}
+	if p := percent(v, "pipe"); p != 0 {
+		t.Errorf("percent = %v, want 0 until completed", p)
+	}
+}
+
+func TestSpinnerStyle(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	v.SpinnerStyle([]rune("ab"))
+	v.Add("a", nil)
+
+	statusOf(v, "a") // the first refresh shows no frame
+	var got []string
+	for i := 0; i < 4; i++ {
+		got = append(got, strings.TrimSpace(statusOf(v, "a")))
+	}
+	want := "0:00    b 0:00    a 0:00    b 0:00    a"
+	if strings.Join(got, " ") != want {
+		t.Errorf("statuses = %q, want frames cycling through %q", got, "ab")
+	}
+}
+
+func TestSpinnerQuick(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	v.Add("quick", nil)
+	v.Add("shown", nil)
+	statusOf(v, "quick") // a refresh before completion
+	v.Complete("quick", nil)
+	v.Complete("shown", nil)
+
+	for y, line := range strings.Split(draw(v, 40, 3).String(), "\n")[1:] {
+		if strings.ContainsAny(line, Wheel) {
+			t.Errorf("row %d = %q, want no wheel frame", y+1, line)
+		}
+		if line != "" && !strings.Contains(line, " 100.00% ") {
+			t.Errorf("row %d = %q, want the final percent", y+1, line)
+		}
+	}
+}
+
+func TestWheelDefault(t *testing.T) {
+	for _, frames := range [][]rune{nil, {}} {
+		var wh wheel
+		wh.setFrames(frames)
+		var got []rune
+		for i := 0; i < 4; i++ {
+			got = append(got, wh.next())
+		}
+		if string(got) != "-\\|/" {
+			t.Errorf("frames %q spin %q, want the default Wheel", frames, string(got))
+		}
+	}
+}
+
+func TestStatusFormat(t *testing.T) {
+	for _, pct := range []float64{0, 0.004, 5, 12.345, 99.999, 100} {
+		if got, want := string(appendPercent(nil, pct)), fmt.Sprintf("%6.2f%%", pct); got != want {
+			t.Errorf("appendPercent(%v) = %q, want %q", pct, got, want)
+		}
+	}
+	for _, n := range []float64{0, 1023, 1024, 1536, 10 << 20, 3 << 30} {
+		want := fmt.Sprintf("%.0f B", n)
+		if n >= 1024 {
+			i, f := -1, n
+			for ; f >= 1024; f /= 1024 {
+				i++
+			}
+			want = fmt.Sprintf("%.1f %cB", f, "KMGTPE"[i])
+		}
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%v) = %q, want %q", n, got, want)
+		}
+	}
+
+	clk := newFakeClock()
+	s := newSpinner()
+	s.setClock(clk.now)
+	s.ReadStatus()
+	clk.advance(2 * time.Second)
+	if got, want := s.ReadStatus(), fmt.Sprintf("0:02    %c   ", []rune(Wheel)[1]); got != want {
+		t.Errorf("spinner status = %q, want %q", got, want)
+	}
+	s.Done()
+	if got := s.ReadStatus(); got != "0:02 100.00%" {
+		t.Errorf("completed status = %q", got)
+	}
+
+	f := sizedFile(t, 10<<20)
+	w := fileStatus(t, f, clk)
+	w.ReadStatus()
+	clk.advance(time.Second)
+	f.Seek(1<<20, io.SeekStart)
+	if got := w.ReadStatus(); got != "0:01  10.00% 307.2 KB/s ETA 0:30" {
+		t.Errorf("file status = %q", got)
+	}
+}
+
+func BenchmarkReadStatus(b *testing.B) {
+	b.Run("spinner", func(b *testing.B) {
+		s := newSpinner()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			s.ReadStatus()
+		}
+	})
+	b.Run("file", func(b *testing.B) {
+		f, err := os.CreateTemp(b.TempDir(), "data")
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer f.Close()
+		f.Truncate(1 << 30)
+		view, err := wrapFile(f)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			f.Seek(int64(i), io.SeekStart)
+			view.ReadStatus()
+		}
+	})
+}
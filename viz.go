@@ -4,19 +4,23 @@
 // BoundedExec will allow calling code to easily limit concurrent readers.
 //
 //    v := &parprog.Viz{}
-//    v.Start(time.Second)
+//    if err := v.Start(time.Second); err != nil {
+//      log.Fatal(err)
+//    }
+//    defer v.Recover() // restore the terminal if anything panics
 //    parprog.BoundedExec(3, flag.Args(), func(fn string) {
 //      basename := filepath.Base(fn)
 //      f, err := os.Open(fn)
-//      v.Add(basename, f) // NB added even if invalid
+//      r := v.AddFile(basename, f) // NB added even if invalid
 //      if err != nil {
 //        // Viz controls the terminal, so this is only way to display errors
 //        v.Complete(basename, err)
 //        return
 //      }
+//      defer f.Close()
 //      defer v.Complete(basename, nil)
 //
-//      // ... long-running code here ...
+//      // ... long-running code reading from r here ...
 //
 //    })
 //    v.Stop()
@@ -24,155 +28,891 @@
 package parprog
 
 import (
+	"bufio"
 	"compress/gzip"
+	"context"
+	"encoding/binary"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/nsf/termbox-go"
+	"golang.org/x/term"
 )
 
 //////////
 
 type readInfo struct {
-	Name  string
-	View  readStatusInterface
-	Error error
+	Name   string
+	View   readStatusInterface
+	Error  error
+	Done   bool
+	Handle *ReaderHandle // nil unless added with AddReader
+	Tag    string        // category set by AddWithTag
+	Label  string        // displayed instead of Name if set, see AddNamed
+	Parent *ReaderHandle // group the reader was added to with AddChild
+
+	Completed time.Time          // when Complete was called
+	Cancel    context.CancelFunc // set by SetCancel
+	Cancelled bool               // Viz.Cancel was called
+}
+
+// label returns the name to display for r.
+func (r readInfo) label() string {
+	if r.Label != "" {
+		return r.Label
+	}
+	return r.Name
+}
+
+// ReaderHandle identifies a reader added with AddReader, so that readers with
+// the same name can be completed or removed independently.
+type ReaderHandle struct {
+	name  string
+	group *groupStatus // non-nil for a Group
 }
 
+// Name returns the display name the reader was added with, or renamed to
+// with Rename. It should not be called concurrently with Rename.
+func (h *ReaderHandle) Name() string {
+	return h.name
+}
+
+// VizMode selects how a Viz displays progress.
+type VizMode int
+
+const (
+	// ModeAuto uses ModeTerminal when stdout is a terminal, and ModePlain
+	// otherwise.
+	ModeAuto VizMode = iota
+	// ModeTerminal draws progress using termbox.
+	ModeTerminal
+	// ModePlain writes plain-text status lines to stderr.
+	ModePlain
+)
+
 // Viz provides a wrapper for multiple progress / status displays for parallel
-// readers in process. The zero value struct is ready to be Start()-ed.
+// readers in process. The zero value struct is ready to be Start()-ed, and
+// readers may be added before it is started.
 type Viz struct {
-	mu      *sync.Mutex
+	mu      sync.Mutex
+	changed *sync.Cond // see changedLocked
 	readers []readInfo
 
+	// display options, set before Start
+	mode       VizMode
+	output     io.Writer
+	bars       bool
+	scroll     ScrollMode
+	sort       SortMode
+	nameWidth  int
+	statusMax  int
+	maxLines   int
+	errMode    ErrorMode
+	columns    []Column
+	compact    bool
+	throughput bool
+	title      bool
+	autoRemove time.Duration
+	frames     []rune
+	colors     *ColorScheme
+	tags       map[string]Style
+	events     *eventSink
+	logs       []string
+
+	onAdd       []func(name string)
+	onComplete  []func(name string, err error, elapsed time.Duration)
+	onInterrupt []func()
+	signals     []os.Signal
+
+	out      io.Writer // non-nil when started with StartWriter
 	interval time.Duration
 	quit     chan int
+	done     chan struct{}
+	redraw   chan struct{}
+	retick   chan time.Duration
+	stopOnce sync.Once
+	paused   bool
 	started  time.Time
+	stopped  time.Time
+	peak     int                            // most readers active at once
+	redraws  int                            // number of redraws, for paging
+	drawErrs int                            // consecutive failed redraws
+	prev     *frame                         // last frame drawn, for diffing
+	render   renderer                       // nil for termbox
+	mirror   string                         // path written by MirrorToFile
+	statuses map[readStatusInterface]string // read this tick, see readStatusLocked
+	nowFunc  func() time.Time               // nil for time.Now, replaced in tests
 }
 
 // Start sets up the terminal for displaying reader progress, refreshed at the
-// given interval in a background goroutine. After calling Start, Stop() must
-// be called to stop the goroutine and return the terminal to a sane state.
-func (v *Viz) Start(refreshInterval time.Duration) {
-	termbox.Init()
+// given interval in a background goroutine. An interval <= 0 uses the one set
+// by WithInterval, or one second. After calling Start, Stop() must be called
+// to stop the goroutine and return the terminal to a sane state.
+//
+// If stdout is not a terminal, Start falls back to writing plain-text status
+// lines to stderr as in StartWriter. Use ForceMode to override this detection.
+//
+// If the terminal cannot be initialized, the error is returned and the Viz is
+// left inactive: Stop becomes a no-op, and readers are tracked but not drawn.
+func (v *Viz) Start(refreshInterval time.Duration) error {
+	if v.render != nil {
+		// set by withRenderer
+		v.init(refreshInterval)
+		go v.run()
+		return nil
+	}
+	mode := v.mode
+	if mode == ModeAuto {
+		mode = ModePlain
+		if isTerminal(os.Stdout) {
+			mode = ModeTerminal
+		}
+	}
+	if mode == ModePlain {
+		w := v.output
+		if w == nil {
+			w = os.Stderr
+		}
+		v.StartWriter(w, refreshInterval)
+		return nil
+	}
+
+	if err := termboxInit(); err != nil {
+		return err
+	}
 	termbox.HideCursor()
-	v.mu = &sync.Mutex{}
-	v.started = time.Now().Truncate(time.Second)
-	v.interval = refreshInterval
-	v.quit = make(chan int)
-	go func() {
-		for {
-			ev := termbox.PollEvent()
-			if ev.Type == termbox.EventInterrupt {
-				// termbox is closing
-				return
-			}
-			if ev.Key == termbox.KeyCtrlC {
-				v.quit <- 1
+	v.init(refreshInterval)
+	go v.poll()
+	go v.run()
+	return nil
+}
+
+// termboxInit initializes the terminal. It is replaced in tests.
+var termboxInit = termbox.Init
+
+// poll handles terminal events until termbox is interrupted.
+func (v *Viz) poll() {
+	for v.handleEvent(termbox.PollEvent()) {
+	}
+}
+
+// handleEvent handles a single terminal event. It reports whether polling
+// should continue.
+func (v *Viz) handleEvent(ev termbox.Event) bool {
+	switch {
+	case ev.Type == termbox.EventInterrupt:
+		// termbox is closing
+		return false
+	case ev.Type == termbox.EventResize:
+		v.requestRedraw()
+	case ev.Key == termbox.KeyCtrlC:
+		return !v.interrupt()
+	}
+	return true
+}
+
+// interrupt runs the OnInterrupt hooks, or if there are none, stops the
+// display and exits the program. It reports whether the display was stopped.
+func (v *Viz) interrupt() bool {
+	if len(v.onInterrupt) > 0 {
+		// run separately, hooks may call Stop
+		for _, fn := range v.onInterrupt {
+			go fn()
+		}
+		return false
+	}
+	select {
+	case v.quit <- 1:
+	case <-v.done:
+	}
+	return true
+}
+
+// HandleSignals treats the given signals (e.g. syscall.SIGTERM in a
+// container) like Ctrl-C: the OnInterrupt hooks are run, or if there are none,
+// the terminal is restored and the program exits. The signal handler is
+// removed when the display stops. It should be called before Start.
+func (v *Viz) HandleSignals(sigs ...os.Signal) {
+	v.signals = sigs
+}
+
+// watchSignals calls interrupt for each signal received on ch, until the
+// display stops.
+func (v *Viz) watchSignals(ch chan os.Signal) {
+	defer signal.Stop(ch)
+	for {
+		select {
+		case <-ch:
+			if v.interrupt() {
 				return
 			}
+		case <-v.done:
+			return
+		}
+	}
+}
+
+// StartContext is like Start, but also stops the display and restores the
+// terminal when ctx is cancelled, so an explicit Stop is not required. This
+// pairs naturally with BoundedExecContext.
+func (v *Viz) StartContext(ctx context.Context, refreshInterval time.Duration) error {
+	if err := v.Start(refreshInterval); err != nil {
+		return err
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			v.Stop()
+		case <-v.done:
 		}
 	}()
+	return nil
+}
+
+// StartWriter is an alternative to Start for when the output is not a
+// terminal (e.g. redirected to a file or running under CI). Instead of drawing
+// with termbox, a plain-text line is written to w for each reader at the given
+// interval. Stop() must still be called to stop the background goroutine.
+func (v *Viz) StartWriter(w io.Writer, refreshInterval time.Duration) {
+	v.out = w
+	v.init(refreshInterval)
+	go v.run()
+}
 
+// StartANSI is an alternative to Start which draws the display in place below
+// any existing output using ANSI escape sequences, rather than taking over the
+// whole screen with termbox. The display is fitted to the size of the
+// terminal, or to $COLUMNS and $LINES if the output is not one, and longer
+// lines are clipped. Stop() must still be called to stop the background
+// goroutine, and leaves the final state of the display on screen.
+func (v *Viz) StartANSI(refreshInterval time.Duration) {
+	w := v.output
+	if w == nil {
+		w = os.Stdout
+	}
+	v.render = newANSIRenderer(w)
+	v.init(refreshInterval)
 	go v.run()
 }
 
+// Output sets where the display is written by StartANSI (stdout by default)
+// and by Start when falling back to plain text (stderr by default), e.g. to
+// keep progress out of a piped stdout. termbox always draws to the terminal.
+// It should be called before Start.
+func (v *Viz) Output(w io.Writer) {
+	v.output = w
+}
+
+// ForceMode pins the display mode used by Start instead of detecting it from
+// stdout. It must be called before Start.
+func (v *Viz) ForceMode(mode VizMode) {
+	v.mode = mode
+}
+
+// isTerminal reports whether f is a terminal. Other character devices, such
+// as /dev/null, are not.
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+func (v *Viz) init(refreshInterval time.Duration) {
+	v.started = v.now().Truncate(time.Second)
+	if refreshInterval > 0 {
+		v.interval = refreshInterval
+	} else if v.interval <= 0 {
+		v.interval = defaultInterval
+	}
+	v.quit = make(chan int)
+	v.done = make(chan struct{})
+	v.redraw = make(chan struct{}, 1)
+	v.retick = make(chan time.Duration)
+	if len(v.signals) > 0 {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, v.signals...)
+		go v.watchSignals(ch)
+	}
+}
+
+func (v *Viz) now() time.Time {
+	if v.nowFunc == nil {
+		return time.Now()
+	}
+	return v.nowFunc()
+}
+
+// setClock replaces the source of the current time used by the Viz and the
+// readers added afterwards, so that tests can control elapsed times.
+func (v *Viz) setClock(now func() time.Time) {
+	v.nowFunc = now
+}
+
+// changedLocked returns the condition signalled when readers are completed or
+// removed, creating it on first use.
+func (v *Viz) changedLocked() *sync.Cond {
+	if v.changed == nil {
+		v.changed = sync.NewCond(&v.mu)
+	}
+	return v.changed
+}
+
+// defaultInterval is the refresh interval used when none is given to Start or
+// WithInterval.
+const defaultInterval = time.Second
+
+// SetInterval changes the refresh interval of a running display. Durations
+// <= 0 are ignored.
+func (v *Viz) SetInterval(d time.Duration) {
+	if d <= 0 || v.retick == nil {
+		return
+	}
+	select {
+	case v.retick <- d:
+	case <-v.done:
+	}
+}
+
+// requestRedraw asks the run goroutine to redraw as soon as possible, without
+// waiting for the next tick.
+func (v *Viz) requestRedraw() {
+	select {
+	case v.redraw <- struct{}{}:
+	default:
+		// a redraw is already pending
+	}
+}
+
 func (v *Viz) run() {
 	ticker := time.NewTicker(v.interval)
+	defer ticker.Stop()
 	for {
+		var err error
 		select {
 		case q := <-v.quit:
-			ticker.Stop()
-			if q == 0 {
-				termbox.Interrupt()
-			}
-			termbox.Close()
-			if q != 0 {
-				os.Exit(q)
-			}
+			v.shutdown(q)
 			return
+		case d := <-v.retick:
+			ticker.Reset(d)
+			v.interval = d
+		case <-v.redraw:
+			v.mu.Lock()
+			if v.out == nil && !v.paused {
+				err = v.redrawLocked()
+			}
+			v.mu.Unlock()
 		case <-ticker.C:
 			v.mu.Lock()
-			v.redrawLocked()
+			v.statuses = make(map[readStatusInterface]string, len(v.readers))
+			v.expireLocked()
+			if v.paused {
+				// nothing to draw
+			} else if v.out != nil {
+				v.writeLocked(v.out)
+			} else {
+				err = v.redrawLocked()
+			}
+			v.emitProgressLocked()
+			v.mirrorLocked()
+			v.statuses = nil
 			v.mu.Unlock()
 		}
+
+		if err == nil {
+			v.drawErrs = 0
+		} else if v.drawErrs++; v.drawErrs >= maxDrawErrors {
+			// the terminal has most likely gone away
+			v.shutdown(0)
+			for _, fn := range v.onInterrupt {
+				go fn()
+			}
+			return
+		}
 	}
 }
 
-func (v *Viz) redrawLocked() {
-	w, h := termbox.Size()
-	termbox.Clear(termbox.ColorBlack, termbox.ColorDefault)
-	ri := len(v.readers)
-	ymax := len(v.readers) + 1
-	if ymax > h {
-		ymax = h
+// maxDrawErrors is the number of consecutive failed redraws after which the
+// display stops.
+const maxDrawErrors = 3
+
+// shutdown restores the terminal and stops the display. A non-zero q exits
+// the program with that status.
+func (v *Viz) shutdown(q int) {
+	v.mu.Lock()
+	v.stopped = v.now()
+	paused := v.paused
+	switch {
+	case v.out != nil:
+		// write out the final state before exiting
+		v.writeLocked(v.out)
+	case v.render != nil && !paused:
+		// leave the final state on screen
+		v.redrawLocked()
+	}
+	if a, ok := v.render.(*ansiRenderer); ok {
+		// the final frame is not drawn while paused
+		a.clearTitle()
 	}
-	now := time.Now().Truncate(time.Second)
-	s := now.Sub(v.started).String()
-	s = "Running for " + s
-	bestETA := time.Time{}
+	var logs []string
+	if v.out == nil && (v.render == nil || paused) {
+		// the final frame showing them is cleared, or was never drawn
+		logs = v.logs
+	}
+	v.mu.Unlock()
+	if v.out == nil && v.render == nil && !paused {
+		// otherwise termbox was already closed by Pause
+		if q == 0 {
+			termbox.Interrupt()
+		}
+		termbox.Close()
+	}
+	for _, msg := range logs {
+		fmt.Fprintln(stderr, msg)
+	}
+	close(v.done)
+	if q != 0 {
+		os.Exit(q)
+	}
+}
+
+// headerLocked returns the summary line displayed above the readers. The ETA
+// is estimated from the total bytes remaining across all sized readers and
+// their combined (smoothed) throughput.
+func (v *Viz) headerLocked() string {
+	now := v.now().Truncate(time.Second)
+	s := "Elapsed " + formatDuration(now.Sub(v.started))
+	var pos, size int64
+	var rate float64
+	ndone := 0
 	for _, r := range v.readers {
-		if fs, ok := r.View.(*fileWrapper); ok {
-			if fs.eta.After(now) && fs.eta.After(bestETA) {
-				bestETA = fs.eta
+		if r.Done {
+			ndone++
+		}
+		if ss, ok := r.View.(sizedStatus); ok {
+			p := ss.progress()
+			if p.size > 0 {
+				pos += p.position()
+				size += p.size
+				if !r.Done {
+					rate += p.rate
+				}
 			}
 		}
 	}
-	if !bestETA.IsZero() {
-		s += ", current ETA " + bestETA.Truncate(time.Second).Sub(now).String()
+	s += fmt.Sprintf(", %d/%d done", ndone, len(v.readers))
+	if size > 0 {
+		s += fmt.Sprintf(", %s / %s (%.2f%%)", formatBytes(float64(pos)),
+			formatBytes(float64(size)), 100.0*float64(pos)/float64(size))
+	}
+	if size > 0 && rate > 0 {
+		remaining := time.Duration(float64(size-pos) / rate * float64(time.Second))
+		s += ", ETA " + formatDuration(remaining)
+	} else {
+		s += ", ETA --"
+	}
+	return s
+}
+
+// writeLocked writes a plain-text status block to w.
+func (v *Viz) writeLocked(w io.Writer) {
+	fmt.Fprintln(w, v.headerLocked())
+	for _, r := range v.readers {
+		es := ""
+		if r.Error != nil {
+			es = r.Error.Error()
+		}
+		indent := ""
+		if r.Parent != nil {
+			indent = "  "
+		}
+		fmt.Fprintf(w, "%15s %s%s %s\n", v.readStatusLocked(r.View), indent, r.label(), es)
+	}
+}
+
+// readStatusLocked returns the status of view. During a tick each view is
+// only read once, even if it is both drawn and mirrored, as reading a status
+// also turns spinners and samples byte rates.
+func (v *Viz) readStatusLocked(view readStatusInterface) string {
+	if v.statuses == nil {
+		return view.ReadStatus()
+	}
+	st, ok := v.statuses[view]
+	if !ok {
+		st = view.ReadStatus()
+		v.statuses[view] = st
 	}
+	return st
+}
 
-	for i, c := range s {
-		if i >= w {
-			break
+// redrawLocked draws the display. It is only called from the run goroutine;
+// elsewhere use requestRedraw.
+func (v *Viz) redrawLocked() error {
+	r := v.surface()
+	w, h := r.Size()
+	v.redraws++
+	if a, ok := r.(*ansiRenderer); ok && v.title {
+		a.title = ""
+		if v.stopped.IsZero() {
+			a.title = v.titleLocked()
 		}
-		termbox.SetCell(i, 0, c, termbox.ColorWhite, termbox.ColorDefault)
+	}
+	f := v.drawLocked(w, h)
+	if err := f.flush(r, v.prev); err != nil {
+		// redraw everything next time
+		v.prev = nil
+		return err
+	}
+	v.prev = f
+	return nil
+}
+
+// drawLocked draws the display into a new frame of the given size.
+func (v *Viz) drawLocked(w, h int) *frame {
+	f := newFrame(w, h)
+	cs := v.colorScheme()
+
+	x := f.drawString(0, 0, v.headerLocked(), cs.Header)
+	compact := v.compact && len(v.readers) <= compactReaders
+	if compact {
+		v.drawCompactLocked(f, x, cs)
+	}
+
+	// reserve up to half the rows below the header for log messages
+	logRows := len(v.logs)
+	if logRows > maxLogRows {
+		logRows = maxLogRows
+	}
+	if logRows > (h-1)/2 {
+		logRows = (h - 1) / 2
 	}
 
-	for y := 1; y < ymax; y++ {
-		ri--
-		r := v.readers[ri]
+	avail := h - 1 - logRows
+	more := 0
+	if v.maxLines > 0 && v.maxLines < avail {
+		avail = v.maxLines
+		if len(v.readers) > avail {
+			// make room for the summary line
+			avail--
+			more = len(v.readers) - avail
+		}
+	}
+	if compact {
+		// everything is on the header line
+		avail, more = 0, 0
+	}
+	rows := v.visibleLocked(avail)
+	// statuses are read up front, as reading them also samples the byte rates
+	statuses := make([]string, len(rows))
+	var maxRate float64
+	statusWidth := 0
+	for i, r := range rows {
+		statuses[i] = v.readStatusLocked(r.View)
+		if r.Cancelled {
+			statuses[i] = "cancelled"
+		}
+		if n := utf8.RuneCountInString(statuses[i]); n > statusWidth {
+			statusWidth = n
+		}
+		if ss, ok := r.View.(sizedStatus); ok && !r.Done && ss.progress().rate > maxRate {
+			maxRate = ss.progress().rate
+		}
+	}
+	if max := v.statusMaxWidth(); statusWidth > max {
+		statusWidth = max
+	}
+	y := 1
+	for ri, r := range rows {
+		if y > avail {
+			// pushed out by wrapped errors
+			break
+		}
+		if len(v.columns) > 0 {
+			y = v.drawColumns(f, y, avail+1, r, statuses[ri], cs)
+			continue
+		}
 		es := ""
 		if r.Error != nil {
 			es = r.Error.Error()
 		}
-		s := fmt.Sprintf("%15s %s %s", r.View.readStatus(), r.Name, es)
-
-		fg := termbox.ColorWhite
-		for i, c := range s {
-			if i >= w {
-				break
-			}
-			if i == 15 {
-				fg = termbox.ColorDefault
-			} else if i == len(s)-len(es) {
-				fg = termbox.ColorRed | termbox.AttrBold
+		st := fitStatus(statuses[ri], statusWidth) + " "
+		if v.throughput {
+			st = throughputStatus(r, statuses[ri], maxRate)
+		}
+		tag, nameColor := v.tagStyle(r, cs)
+		s := v.fitName(r.label()) + " "
+		if r.Parent != nil {
+			s = "  " + s
+		}
+		if ss, ok := r.View.(sizedStatus); ok && v.bars && ss.progress().size > 0 {
+			if bw := w - utf8.RuneCountInString(st+tag+s) - 1; bw >= minBarWidth {
+				s += progressBar(ss.progress().pct, bw) + " "
 			}
-			termbox.SetCell(i, y, c, fg, termbox.ColorDefault)
 		}
+
+		statusColor := cs.Status
+		if r.Error != nil && !r.Cancelled {
+			// highlight the whole row
+			statusColor, nameColor = cs.Error, cs.Error
+		}
+		x := f.drawString(0, y, st, statusColor)
+		if tag != "" {
+			x = f.drawString(x, y, tag, v.tags[r.Tag].Color)
+		}
+		x = f.drawString(x, y, s, nameColor)
+		y = v.drawError(f, x, y, avail+1, es, cs.Error)
+	}
+
+	if more > 0 {
+		f.drawString(0, y, fmt.Sprintf("%s and %d more", ellipsis, more), cs.Status)
+		y++
+	}
+	for i, msg := range v.logs[len(v.logs)-logRows:] {
+		f.drawString(0, y+i, msg, cs.Log)
+	}
+	return f
+}
+
+// MirrorToFile also writes the display as plain text (as in RenderString) to
+// the file at path on every refresh, replacing its contents each time, so that
+// progress can be followed from elsewhere, e.g. with "watch cat path". If the
+// file cannot be written, the error is logged and mirroring stops. It should
+// be called before Start.
+func (v *Viz) MirrorToFile(path string) {
+	v.mirror = path
+}
+
+// mirrorLocked writes the display to the MirrorToFile path, if any.
+func (v *Viz) mirrorLocked() {
+	if v.mirror == "" {
+		return
+	}
+	if err := os.WriteFile(v.mirror, []byte(v.renderStringLocked()), 0644); err != nil {
+		v.mirror = ""
+		v.logLocked(fmt.Sprintf("parprog: mirroring stopped: %v", err))
+	}
+}
+
+// previewWidth is the width used by RenderString when not drawing to a
+// renderer with a known size.
+const previewWidth = 80
+
+// RenderString returns the display as it would currently be drawn, without
+// colors, as newline-separated rows with trailing blanks removed. Rows are as
+// wide as the terminal drawn to, or 80 columns with Start or StartWriter, and
+// there are enough of them to show every reader. It is useful for demos and
+// golden-file tests.
+func (v *Viz) RenderString() string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.renderStringLocked()
+}
+
+func (v *Viz) renderStringLocked() string {
+	w := previewWidth
+	if v.render != nil {
+		w, _ = v.render.Size()
+	}
+	// room for the header, every reader and the logs (which may take up to
+	// half of the rows)
+	h := 2 + len(v.readers) + maxLogRows*2
+	m := newMemRenderer(w, h)
+	v.drawLocked(w, h).flush(m, nil)
+	return strings.TrimRight(m.String(), "\n") + "\n"
+}
+
+// surface returns the renderer to draw on, defaulting to termbox.
+func (v *Viz) surface() renderer {
+	if v.render == nil {
+		return termboxRenderer{}
+	}
+	return v.render
+}
+
+// ShowBars toggles drawing a progress bar for readers with a known size. It
+// should be called before Start.
+func (v *Viz) ShowBars(show bool) {
+	v.bars = show
+}
+
+const (
+	minBarWidth = 5
+	maxBarWidth = 40
+)
+
+// progressBar renders pct (0-100) as a bar like "[####----]" at most width
+// characters wide.
+func progressBar(pct float64, width int) string {
+	if width > maxBarWidth {
+		width = maxBarWidth
+	}
+	inner := width - 2
+	n := int(pct / 100.0 * float64(inner))
+	if n < 0 {
+		n = 0
+	} else if n > inner {
+		n = inner
 	}
-	termbox.Flush()
+	return "[" + strings.Repeat("#", n) + strings.Repeat("-", inner-n) + "]"
 }
 
-// Stop kills the display goroutine and cleans up the terminal display.
+// Stop kills the display goroutine and cleans up the terminal display. It is
+// safe to call more than once, and returns immediately if the display
+// goroutine has already exited.
 func (v *Viz) Stop() {
-	v.quit <- 0
-	time.Sleep(v.interval)
+	if v.quit == nil {
+		return
+	}
+	v.stopOnce.Do(func() {
+		select {
+		case v.quit <- 0:
+			<-v.done
+		case <-v.done:
+		}
+	})
+}
+
+// Pause stops drawing and returns the terminal to its normal state, e.g. to
+// prompt the user for input, without losing any reader state. Readers may
+// still be added and completed, and elapsed times keep advancing while paused.
+// Call Resume to start drawing again. It does nothing once the display has
+// stopped.
+func (v *Viz) Pause() {
+	if v.quit == nil {
+		return
+	}
+	v.mu.Lock()
+	if v.paused || !v.stopped.IsZero() {
+		v.mu.Unlock()
+		return
+	}
+	v.paused = true
+	closeTermbox := false
+	if a, ok := v.render.(*ansiRenderer); ok {
+		// output written while paused goes below the current block
+		a.release()
+	} else if v.out == nil && v.render == nil {
+		closeTermbox = true
+	}
+	v.mu.Unlock()
+	if closeTermbox {
+		// outside the lock, as poll may be waiting on it to handle a Ctrl-C.
+		// shutdown leaves termbox alone now that paused is set.
+		termbox.Interrupt() // stops poll
+		termbox.Close()
+	}
+}
+
+// Resume takes over the terminal again after Pause, and redraws the display
+// immediately. If the terminal cannot be re-initialized the error is returned
+// and the Viz remains paused. It does nothing once the display has stopped.
+func (v *Viz) Resume() error {
+	if v.quit == nil {
+		return nil
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if !v.paused || !v.stopped.IsZero() {
+		return nil
+	}
+	if v.out == nil && v.render == nil {
+		if err := termboxInit(); err != nil {
+			return err
+		}
+		termbox.HideCursor()
+		go v.poll()
+	}
+	v.prev = nil
+	v.paused = false
+	v.requestRedraw()
+	return nil
+}
+
+// PrintSummary writes a plain-text summary of every reader's final status,
+// elapsed time and error to w. It is intended to be called after Stop, once
+// the terminal has been restored. Readers which were Removed do not appear.
+func (v *Viz) PrintSummary(w io.Writer) {
+	v.mu.Lock()
+	v.writeLocked(w)
+	v.mu.Unlock()
+}
+
+// Recover restores the terminal if the program is panicking, then continues
+// the panic. It must be deferred directly, immediately after a successful
+// Start, e.g.:
+//
+//	defer v.Recover()
+//
+// Since BoundedExec re-raises worker panics in the calling goroutine when
+// OnPanic is not set, this also covers panics in bounded tasks. Panics in other goroutines cannot be
+// recovered here and will still leave the terminal in raw mode.
+func (v *Viz) Recover() {
+	if r := recover(); r != nil {
+		v.Stop()
+		panic(r)
+	}
 }
 
 // Add a reader to the Viz. An *os.File will give best results showing percent
 // completion using Seek and Stat calls to compute offsets and file size.
 // Otherwise, a spinner will be displayed along with the name and time elapsed.
+//
+// NB for an *os.File the display goroutine reads the offset with Seek(0,
+// io.SeekCurrent) on the same file descriptor your code is reading from. This
+// only queries the offset, but it does mean a file must not be shared with
+// code that relies on the offset staying put between calls. The same applies
+// to AddReader, AddNamed, AddWithTag, AddChild, AddGzip and AddBuffered. Use
+// AddFile, AddSized or AddCounting to track progress by counting bytes as
+// they are read instead.
 func (v *Viz) Add(name string, rdr interface{}) {
+	v.add(newReadInfo(name, rdr))
+}
+
+// AddReader is like Add, but returns a handle which can be used with
+// CompleteHandle and RemoveHandle. The name is then only used for display, so
+// duplicate names (e.g. the same basename in different directories) do not
+// clobber each other.
+func (v *Viz) AddReader(name string, rdr interface{}) *ReaderHandle {
+	info := newReadInfo(name, rdr)
+	info.Handle = &ReaderHandle{name: name}
+	v.add(info)
+	return info.Handle
+}
+
+// AddNamed is like Add, but displays the reader as display while using key to
+// look it up in Complete, Remove and so on, e.g. a unique path shown by its
+// basename. If either is empty the other is used for both.
+func (v *Viz) AddNamed(key, display string, rdr interface{}) {
+	if key == "" {
+		key = display
+	}
+	info := newReadInfo(key, rdr)
+	info.Label = display
+	v.add(info)
+}
+
+// AddWithTag is like Add, but also sets a category tag for the reader. If a
+// Style was configured for the tag with TagStyle, its glyph is drawn ahead of
+// the name and its color is used for the name while the reader is running.
+// Unknown tags are drawn with the default styling.
+func (v *Viz) AddWithTag(name, tag string, rdr interface{}) {
+	info := newReadInfo(name, rdr)
+	info.Tag = tag
+	v.add(info)
+}
+
+// newReadInfo chooses the best status display for rdr.
+func newReadInfo(name string, rdr interface{}) readInfo {
 	info := readInfo{
 		Name: name,
 	}
 
 	switch x := rdr.(type) {
 	case *gzip.Reader:
-		info.Error = fmt.Errorf("cannot inspect gzip.Reader, use wrapped Reader")
+		info.Error = fmt.Errorf("cannot inspect gzip.Reader, use AddGzip")
 		info.View = newSpinner()
 
 	case *os.File:
@@ -183,43 +923,434 @@ func (v *Viz) Add(name string, rdr interface{}) {
 	default:
 		info.View = newSpinner()
 	}
+	return info
+}
+
+// AddCustom adds a reader to the Viz with a caller-supplied status display.
+func (v *Viz) AddCustom(name string, r StatusRenderer) {
+	v.add(readInfo{Name: name, View: newCustomStatus(r)})
+}
+
+// AddFile adds a file to the Viz, showing percent completion of its size. The
+// returned io.Reader must be used in place of f so that bytes can be counted
+// as they are read, rather than seeking the file while it is in use. If f
+// cannot be inspected (e.g. it is nil because os.Open failed), a spinner is
+// displayed along with the error and f is returned as-is.
+func (v *Viz) AddFile(name string, f *os.File) io.Reader {
+	info, err := f.Stat()
+	if err != nil {
+		v.add(readInfo{Name: name, View: newSpinner(), Error: err})
+		return f
+	}
+	cr := newCountingReader(f, info.Size())
+	if pos, err := f.Seek(0, io.SeekCurrent); err == nil {
+		// nothing is reading yet, so this is safe
+		cr.n = pos
+	}
+	v.add(readInfo{Name: name, View: cr})
+	return cr.wrap()
+}
+
+// AddGzip adds a gzip reader to the Viz, showing percent completion of the
+// underlying compressed file it was created from. Since the compressed offset
+// advances in step with decompression, this is a good proxy for completion.
+// The offset of underlying is read with Seek, as in Add; AddGzipEstimated
+// counts bytes instead.
+func (v *Viz) AddGzip(name string, gz *gzip.Reader, underlying *os.File) {
+	v.addOffset(name, underlying)
+}
+
+// AddGzipEstimated adds a gzip reader to the Viz, showing percent completion
+// of the decompressed data, estimated from the uncompressed size recorded in
+// the gzip footer of f. The returned io.Reader must be used in place of gz so
+// that decompressed bytes can be counted. If the size cannot be read, the
+// decompressed byte count is shown with a spinner instead.
+//
+// NB the footer only records the size modulo 2^32, so for data over 4 GB the
+// estimate is too small and the percent reaches 100% early. For files with
+// several gzip members, only the last member's size is known.
+func (v *Viz) AddGzipEstimated(name string, gz *gzip.Reader, f *os.File) io.Reader {
+	return v.AddSized(name, gz, gzipSize(f))
+}
+
+// gzipSize returns the uncompressed size recorded in the footer of the gzip
+// file f, or 0 if it cannot be read. ReadAt is used so that the offset of f is
+// left alone.
+func gzipSize(f *os.File) int64 {
+	info, err := f.Stat()
+	// a 10 byte header and 8 byte footer at least
+	if err != nil || info.Size() < 18 {
+		return 0
+	}
+	var isize [4]byte
+	if _, err := f.ReadAt(isize[:], info.Size()-4); err != nil {
+		return 0
+	}
+	return int64(binary.LittleEndian.Uint32(isize[:]))
+}
+
+// addOffset adds a reader whose progress is shown from the offset of f.
+func (v *Viz) addOffset(name string, f *os.File) {
+	info := readInfo{
+		Name: name,
+	}
+	info.View, info.Error = wrapFile(f)
+	if info.Error != nil {
+		info.View = newSpinner()
+	}
+	v.add(info)
+}
+
+// AddBuffered adds a bufio.Reader to the Viz, showing percent completion of
+// the underlying file it was created from.
+//
+// NB the file offset runs ahead of what has actually been consumed by up to
+// br.Size() bytes, since br cannot safely be inspected from the display
+// goroutine. For small files this makes the percent jump ahead early. The
+// offset of f is read with Seek, as in Add.
+func (v *Viz) AddBuffered(name string, br *bufio.Reader, f *os.File) {
+	v.addOffset(name, f)
+}
+
+// AddSized adds a reader with a known total size in bytes to the Viz. The
+// returned io.Reader must be used in place of rdr so that bytes can be counted
+// as they are read. It also implements io.Closer and io.WriterTo if rdr does.
+// A total <= 0 is treated as an unknown size, as in AddCounting.
+func (v *Viz) AddSized(name string, rdr io.Reader, total int64) io.Reader {
+	cr := newCountingReader(rdr, total)
+	v.add(readInfo{Name: name, View: cr})
+	return cr.wrap()
+}
+
+// AddSection adds a section of a larger file to the Viz, e.g. when reading
+// byte ranges of one file in parallel, with percent completion relative to the
+// section's length. The returned SectionReader must be used in place of sr so
+// that the offset within the section, or the bytes read with ReadAt, can be
+// tracked.
+func (v *Viz) AddSection(name string, sr *io.SectionReader) SectionReader {
+	s := &sectionReader{sr: sr, byteCounter: byteCounter{byteProgress: newByteProgress(sr.Size())}}
+	if pos, err := sr.Seek(0, io.SeekCurrent); err == nil {
+		s.n = pos
+	}
+	v.add(readInfo{Name: name, View: s})
+	return s
+}
 
+// AddCounting adds a reader of unknown size to the Viz. The returned io.Reader
+// must be used in place of rdr so that the number of bytes read can be shown
+// alongside a spinner. It also implements io.Closer and io.WriterTo if rdr
+// does.
+func (v *Viz) AddCounting(name string, rdr io.Reader) io.Reader {
+	return v.AddSized(name, rdr, 0)
+}
+
+// AddWriter adds a writer with a known total size in bytes to the Viz, for
+// example when downloading to disk. The returned io.Writer must be used in
+// place of w so that bytes can be counted as they are written. It also
+// implements io.Closer if w does. A total <= 0 is treated as an unknown size.
+func (v *Viz) AddWriter(name string, w io.Writer, total int64) io.Writer {
+	bc := &byteCounter{byteProgress: newByteProgress(total)}
+	v.add(readInfo{Name: name, View: bc})
+	return countingWriter{w: w, n: &bc.n}.wrap()
+}
+
+func (v *Viz) add(info readInfo) {
+	if wh, ok := info.View.(interface{ setFrames([]rune) }); ok {
+		wh.setFrames(v.frames)
+	}
+	if c, ok := info.View.(interface{ setClock(func() time.Time) }); ok && v.nowFunc != nil {
+		c.setClock(v.nowFunc)
+	}
 	v.mu.Lock()
 	v.readers = append(v.readers, info)
-	v.redrawLocked()
+	if p := info.Parent; p != nil && p.group != nil {
+		p.group.children = append(p.group.children, info.View)
+	}
+	active := 0
+	for _, r := range v.readers {
+		if !r.Done {
+			active++
+		}
+	}
+	if active > v.peak {
+		v.peak = active
+	}
+	v.emit("add", info)
 	v.mu.Unlock()
+	// drawing only happens in the run goroutine
+	v.requestRedraw()
+
+	for _, fn := range v.onAdd {
+		fn(info.Name)
+	}
 }
 
 // Complete marks a reader as completed in the Viz by name. If an error is
-// provided, it will be added to the display.
-func (v *Viz) Complete(name string, err error) {
+// provided, it will be added to the display. It returns false if no reader
+// with that name was found, e.g. when Add was given a full path but Complete
+// a basename.
+func (v *Viz) Complete(name string, err error) bool {
+	return v.complete(func(r readInfo) bool { return r.Name == name }, err)
+}
+
+// CompleteHandle marks the reader added with AddReader as completed. If an
+// error is provided, it will be added to the display. It returns false if the
+// reader was already removed.
+func (v *Viz) CompleteHandle(h *ReaderHandle, err error) bool {
+	return v.complete(func(r readInfo) bool { return r.Handle == h }, err)
+}
+
+// complete marks the first matching reader which is not yet done as
+// completed, and reports whether any reader matched. Completing a reader a
+// second time has no effect, so its first elapsed time and error stand.
+func (v *Viz) complete(match func(readInfo) bool, err error) bool {
 	v.mu.Lock()
-	defer v.mu.Unlock()
+	found := false
 	for i, x := range v.readers {
-		if x.Name == name {
-			x.View.done()
+		if !match(x) {
+			continue
+		}
+		found = true
+		if !x.Done {
+			x.View.Done()
 			x.Error = err
+			x.Done = true
+			x.Completed = v.now()
 			v.readers[i] = x
-			return
+			v.emit("complete", x)
+			v.changedLocked().Broadcast()
+			elapsed := x.View.elapsedTime()
+			parentDone := v.closedDoneLocked(x.Parent)
+			v.mu.Unlock()
+			// show the final status without waiting for the next tick
+			v.requestRedraw()
+
+			for _, fn := range v.onComplete {
+				fn(x.Name, err, elapsed)
+			}
+			if parentDone {
+				v.complete(func(r readInfo) bool { return r.Handle == x.Parent }, nil)
+			}
+			return true
 		}
 	}
+	v.mu.Unlock()
+	return found
 }
 
-// Remove a reader from the Viz by name.
-func (v *Viz) Remove(name string) {
+// WaitAll blocks until every reader added so far has been completed or
+// removed. Only the readers present when WaitAll is called are waited for;
+// readers added while it is waiting are not.
+func (v *Viz) WaitAll() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	var pending []readStatusInterface
+	for _, r := range v.readers {
+		if !r.Done {
+			pending = append(pending, r.View)
+		}
+	}
+	for len(pending) > 0 {
+		if v.activeLocked(pending[len(pending)-1]) {
+			v.changedLocked().Wait()
+			continue
+		}
+		pending = pending[:len(pending)-1]
+	}
+}
+
+// activeLocked reports whether the reader with the given view is still
+// present and not yet completed.
+func (v *Viz) activeLocked(view readStatusInterface) bool {
+	for _, r := range v.readers {
+		if r.View == view {
+			return !r.Done
+		}
+	}
+	return false
+}
+
+// Rename changes the name of a reader, which is then displayed and looked up
+// by newName, keeping its progress and state. A label set with AddNamed is
+// still displayed instead, unless it was oldName. It returns false, leaving
+// the reader alone, if no reader is named oldName or if newName is already
+// taken.
+func (v *Viz) Rename(oldName, newName string) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	idx := -1
+	for i, r := range v.readers {
+		if r.Name == newName {
+			return false
+		}
+		if r.Name == oldName && idx < 0 {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		return false
+	}
+	r := &v.readers[idx]
+	r.Name = newName
+	if r.Label == oldName {
+		r.Label = ""
+	}
+	if r.Handle != nil {
+		r.Handle.name = newName
+	}
+	v.requestRedraw()
+	return true
+}
+
+// SetProgress reports how far along a reader is, as a fraction from 0.0 to
+// 1.0, for work with a known number of steps that is not driven by a file
+// offset. The reader's spinner is replaced by the percentage. Out of range
+// values are clamped. It returns false if no reader with that name was found,
+// or if the reader already tracks its own progress (e.g. an *os.File).
+func (v *Viz) SetProgress(name string, fraction float64) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, x := range v.readers {
+		if x.Name == name {
+			sp, ok := x.View.(interface{ setProgress(float64) })
+			if ok {
+				sp.setProgress(fraction)
+			}
+			return ok
+		}
+	}
+	return false
+}
+
+// Error returns the error the named reader was completed with, and whether a
+// reader with that name was found. The error is nil for readers which are
+// still running or completed successfully.
+func (v *Viz) Error(name string) (error, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, x := range v.readers {
+		if x.Name == name {
+			return x.Error, true
+		}
+	}
+	return nil, false
+}
+
+// SetCancel registers the func which stops the named reader's work, usually
+// that of the context it runs under, to be called by Cancel. It returns false
+// if no reader with that name was found.
+func (v *Viz) SetCancel(name string, cancel context.CancelFunc) bool {
 	v.mu.Lock()
 	defer v.mu.Unlock()
 	for i, x := range v.readers {
 		if x.Name == name {
-			if i == len(v.readers)-1 {
-				v.readers = v.readers[:i-1]
-				return
+			v.readers[i].Cancel = cancel
+			return true
+		}
+	}
+	return false
+}
+
+// Cancel aborts the first named reader which is not yet done, e.g. a corrupt
+// file, while the others carry on. Its cancel func from SetCancel is called,
+// and the reader is shown as cancelled. It is still completed as usual once
+// its work returns. It returns false if no such reader was found.
+func (v *Viz) Cancel(name string) bool {
+	v.mu.Lock()
+	var cancel context.CancelFunc
+	found := false
+	for i, x := range v.readers {
+		if x.Name == name && !x.Done {
+			v.readers[i].Cancelled = true
+			cancel, found = x.Cancel, true
+			break
+		}
+	}
+	v.mu.Unlock()
+	if !found {
+		return false
+	}
+	if cancel != nil {
+		cancel()
+	}
+	v.requestRedraw()
+	return true
+}
+
+// Remove a reader from the Viz by name.
+func (v *Viz) Remove(name string) {
+	v.remove(func(r readInfo) bool { return r.Name == name })
+}
+
+// RemoveHandle removes the reader added with AddReader from the Viz.
+func (v *Viz) RemoveHandle(h *ReaderHandle) {
+	v.remove(func(r readInfo) bool { return r.Handle == h })
+}
+
+// remove removes the first reader matching, and reports whether one was found.
+func (v *Viz) remove(match func(readInfo) bool) bool {
+	v.mu.Lock()
+	for i, x := range v.readers {
+		if match(x) {
+			v.removeLocked(i)
+			// the rest of a closed group may already be done
+			parentDone := v.closedDoneLocked(x.Parent)
+			v.mu.Unlock()
+			if parentDone {
+				v.CompleteHandle(x.Parent, nil)
+			}
+			return true
+		}
+	}
+	v.mu.Unlock()
+	return false
+}
+
+// removeLocked removes the i'th reader, along with its children if it is a
+// group. Children are always added after their group, so readers before i are
+// not moved.
+func (v *Viz) removeLocked(i int) {
+	x := v.readers[i]
+	v.emit("remove", x)
+	v.readers = append(v.readers[:i], v.readers[i+1:]...)
+	if p := x.Parent; p != nil && p.group != nil {
+		p.group.removeChild(x.View)
+	}
+	if x.Handle != nil && x.Handle.group != nil {
+		// drop the group's children along with it
+		rs := v.readers[:0]
+		for _, r := range v.readers {
+			if r.Parent != x.Handle {
+				rs = append(rs, r)
 			}
+		}
+		v.readers = rs
+	}
+	v.changedLocked().Broadcast()
+	v.requestRedraw()
+}
 
-			rr := v.readers[i+1:]
-			v.readers = v.readers[:i]
-			v.readers = append(v.readers, rr...)
-			return
+// AutoRemove removes readers once they have been completed for the given
+// duration, keeping the display focused on active work. Children of a group
+// are removed along with the group. The default of 0 keeps completed readers
+// forever. It should be called before Start.
+func (v *Viz) AutoRemove(after time.Duration) {
+	v.autoRemove = after
+}
+
+// expireLocked removes readers completed longer ago than the AutoRemove
+// duration.
+func (v *Viz) expireLocked() {
+	if v.autoRemove <= 0 {
+		return
+	}
+	now := v.now()
+	for i := 0; i < len(v.readers); {
+		r := v.readers[i]
+		if r.Done && r.Parent == nil && now.Sub(r.Completed) >= v.autoRemove {
+			v.removeLocked(i)
+			continue
 		}
+		i++
 	}
 }
@@ -0,0 +1,1107 @@
+package parprog
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nsf/termbox-go"
+)
+
+// readerNames returns the names of v's readers, in the order they were added.
+func readerNames(v *Viz) []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	names := []string{}
+	for _, r := range v.readers {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+func TestRemove(t *testing.T) {
+	tests := []struct {
+		readers string
+		remove  string
+		want    string
+	}{
+		{"a", "a", ""},
+		{"a b", "a", "b"},
+		{"a b", "b", "a"},
+		{"a b c d", "a", "b c d"},
+		{"a b c d", "c", "a b d"},
+		{"a b c d", "d", "a b c"},
+		{"a b", "missing", "a b"},
+	}
+	for _, tt := range tests {
+		v := &Viz{}
+		for _, name := range strings.Fields(tt.readers) {
+			v.Add(name, nil)
+		}
+		v.Remove(tt.remove)
+		if got := readerNames(v); !reflect.DeepEqual(got, strings.Fields(tt.want)) {
+			t.Errorf("Remove(%q) from %q left %q, want %q", tt.remove, tt.readers, got, tt.want)
+		}
+	}
+}
+
+func TestCompleteFound(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	v.Add("dir/data.txt", nil)
+	if v.Complete("data.txt", nil) {
+		t.Error("Complete found a name that was never added")
+	}
+	if !v.Complete("dir/data.txt", nil) {
+		t.Error("Complete did not find the added reader")
+	}
+	v.Remove("dir/data.txt")
+	if v.Complete("dir/data.txt", nil) {
+		t.Error("Complete found a removed reader")
+	}
+}
+
+func TestError(t *testing.T) {
+	var zero Viz
+	if _, found := zero.Error("a"); found {
+		t.Error("a zero Viz found a reader")
+	}
+
+	v := newTestViz(newFakeClock())
+	v.Add("ok", nil)
+	v.Add("failed", nil)
+	v.Add("running", nil)
+	failed := errors.New("failed")
+	v.Complete("ok", nil)
+	v.Complete("failed", failed)
+
+	tests := []struct {
+		name  string
+		err   error
+		found bool
+	}{
+		{"ok", nil, true},
+		{"failed", failed, true},
+		{"running", nil, true},
+		{"missing", nil, false},
+	}
+	for _, tt := range tests {
+		err, found := v.Error(tt.name)
+		if err != tt.err || found != tt.found {
+			t.Errorf("Error(%q) = %v, %v; want %v, %v", tt.name, err, found, tt.err, tt.found)
+		}
+	}
+}
+
+func TestCancel(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	v.Add("corrupt", nil)
+	v.Add("fine", nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	if v.SetCancel("missing", cancel) {
+		t.Error("SetCancel found a reader that was never added")
+	}
+	if !v.SetCancel("corrupt", cancel) {
+		t.Fatal("SetCancel did not find the reader")
+	}
+	if !v.Cancel("corrupt") {
+		t.Fatal("Cancel did not find the reader")
+	}
+	if ctx.Err() == nil {
+		t.Error("the registered cancel func was not called")
+	}
+	if v.Cancel("missing") {
+		t.Error("Cancel found a reader that was never added")
+	}
+
+	m := draw(v, 60, 4)
+	if !strings.Contains(m.String(), "corrupt") {
+		t.Fatalf("display %q does not show the cancelled reader", m.String())
+	}
+	for y, line := range strings.Split(m.String(), "\n")[1:] {
+		switch {
+		case strings.Contains(line, "corrupt"):
+			if !strings.Contains(line, "cancelled") {
+				t.Errorf("row = %q, want it shown as cancelled", line)
+			}
+			if got := cellAt(t, m, y+1, "corrupt").Fg; got != DefaultColors.Cancelled {
+				t.Errorf("name drawn in %v, want %v", got, DefaultColors.Cancelled)
+			}
+		case strings.Contains(line, "fine") && strings.Contains(line, "cancelled"):
+			t.Errorf("row = %q, want only the cancelled reader shown so", line)
+		}
+	}
+}
+
+func TestHandles(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	a := v.AddReader("data.txt", nil)
+	b := v.AddReader("data.txt", nil)
+
+	errB := errors.New("b failed")
+	if !v.CompleteHandle(b, errB) {
+		t.Fatal("CompleteHandle did not find b")
+	}
+	st := v.Snapshot()
+	if len(st) != 2 || st[0].Done || !st[1].Done || st[1].Err != errB {
+		t.Fatalf("after completing b: %+v", st)
+	}
+	if !v.CompleteHandle(a, nil) {
+		t.Fatal("CompleteHandle did not find a")
+	}
+	if st := v.Snapshot(); !st[0].Done || st[0].Err != nil || st[1].Err != errB {
+		t.Errorf("after completing a: %+v", st)
+	}
+
+	v.RemoveHandle(a)
+	if st := v.Snapshot(); len(st) != 1 || st[0].Err != errB {
+		t.Errorf("RemoveHandle(a) left %+v", st)
+	}
+	if v.CompleteHandle(a, nil) {
+		t.Error("CompleteHandle found the removed reader")
+	}
+}
+
+// within fails the test if fn does not return within d.
+func within(t *testing.T, d time.Duration, what string, fn func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+	select {
+	case <-done:
+	case <-time.After(d):
+		t.Fatalf("%s did not return within %v", what, d)
+	}
+}
+
+func TestStopAfterExit(t *testing.T) {
+	v := &Viz{}
+	v.out = io.Discard
+	v.init(time.Hour)
+	// as if run had already returned after a Ctrl-C
+	close(v.done)
+	within(t, time.Second, "Stop", v.Stop)
+}
+
+func TestStopTwice(t *testing.T) {
+	v := &Viz{}
+	v.StartWriter(io.Discard, time.Hour)
+	within(t, time.Second, "Stop", v.Stop)
+	within(t, time.Second, "second Stop", v.Stop)
+}
+
+func TestStopNotStarted(t *testing.T) {
+	v := &Viz{}
+	within(t, time.Second, "Stop", v.Stop)
+}
+
+func TestStartInitError(t *testing.T) {
+	initErr := errors.New("no terminal")
+	defer func(init func() error) { termboxInit = init }(termboxInit)
+	termboxInit = func() error { return initErr }
+
+	v := &Viz{}
+	v.ForceMode(ModeTerminal)
+	if err := v.Start(time.Second); err != initErr {
+		t.Fatalf("Start returned %v, want %v", err, initErr)
+	}
+	// the Viz is left inactive, but still usable
+	v.Add("a", nil)
+	if !v.Complete("a", nil) {
+		t.Error("Complete did not find the reader")
+	}
+	within(t, time.Second, "Stop", v.Stop)
+}
+
+// syncBuffer is a bytes.Buffer which can be written by the display goroutine
+// while the test reads it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestStartWriter(t *testing.T) {
+	var buf syncBuffer
+	v := &Viz{}
+	v.Add("a.txt", nil)
+	v.StartWriter(&buf, time.Hour)
+	v.Add("b.txt", nil)
+	v.Complete("a.txt", errors.New("bad header"))
+	v.Remove("missing")
+	v.Stop()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("wrote %d lines, want a header and 2 readers:\n%s", len(lines), buf.String())
+	}
+	if !strings.HasPrefix(lines[0], "Elapsed ") || !strings.Contains(lines[0], "1/2 done") {
+		t.Errorf("header = %q", lines[0])
+	}
+	if !strings.HasSuffix(lines[1], " 100.00% a.txt bad header") {
+		t.Errorf("completed reader = %q", lines[1])
+	}
+	if !strings.HasSuffix(strings.TrimSpace(lines[2]), "b.txt") {
+		t.Errorf("running reader = %q", lines[2])
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer null.Close()
+	if isTerminal(null) {
+		t.Errorf("%s is reported as a terminal", os.DevNull)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	if isTerminal(w) {
+		t.Error("a pipe is reported as a terminal")
+	}
+}
+
+func TestForceModePlain(t *testing.T) {
+	var buf syncBuffer
+	v := &Viz{}
+	v.ForceMode(ModePlain)
+	v.Output(&buf)
+	if err := v.Start(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	v.Add("a.txt", nil)
+	v.Stop()
+	if !strings.Contains(buf.String(), "a.txt") {
+		t.Errorf("plain mode wrote %q", buf.String())
+	}
+}
+
+// fakeClock is a time source for tests which only moves when advanced.
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.t = c.t.Add(d)
+	c.mu.Unlock()
+}
+
+// newTestViz returns a Viz started (but not drawing) at the time of clk.
+func newTestViz(clk *fakeClock) *Viz {
+	v := &Viz{}
+	v.setClock(clk.now)
+	v.started = clk.now()
+	return v
+}
+
+// draw draws v onto an in-memory surface of the given size.
+func draw(v *Viz, w, h int) *memRenderer {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	m := newMemRenderer(w, h)
+	v.drawLocked(w, h).flush(m, nil)
+	return m
+}
+
+// row returns row y of m, with trailing spaces removed.
+func row(m *memRenderer, y int) string {
+	return strings.Split(m.String(), "\n")[y]
+}
+
+func TestShowBars(t *testing.T) {
+	f := sizedFile(t, 1000)
+	f.Seek(500, io.SeekStart)
+	v := newTestViz(newFakeClock())
+	v.ShowBars(true)
+	v.Add("half", f)
+
+	got := row(draw(v, 80, 5), 1)
+	want := "half [###################-------------------]"
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("row = %q, want it to end with %q", got, want)
+	}
+
+	// too narrow for a bar
+	got = row(draw(v, 30, 5), 1)
+	if strings.Contains(got, "[") {
+		t.Errorf("narrow row = %q, want no bar", got)
+	}
+
+	v.ShowBars(false)
+	if got := row(draw(v, 80, 5), 1); strings.Contains(got, "[") {
+		t.Errorf("row without bars = %q", got)
+	}
+}
+
+// statusOf refreshes and returns the status of the named reader, as the
+// display goroutine would.
+func statusOf(v *Viz, name string) string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, r := range v.readers {
+		if r.Name == name {
+			return r.View.ReadStatus()
+		}
+	}
+	return ""
+}
+
+// percent returns the percent completion of the named reader.
+func percent(v *Viz, name string) float64 {
+	for _, rs := range v.Snapshot() {
+		if rs.Name == name {
+			return rs.Percent
+		}
+	}
+	return -1
+}
+
+// gzipFile returns a gzip file holding n random (so incompressible) bytes,
+// opened for reading.
+func gzipFile(t *testing.T, n int) *os.File {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "data.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := gzip.NewWriter(f)
+	if _, err := io.CopyN(zw, rand.New(rand.NewSource(1)), int64(n)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if f, err = os.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestAddGzip(t *testing.T) {
+	f := gzipFile(t, 1<<20)
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := newTestViz(newFakeClock())
+	v.AddGzip("data.gz", gz, f)
+
+	last := -1.0
+	buf := make([]byte, 64<<10)
+	for {
+		_, err := io.ReadFull(gz, buf)
+		statusOf(v, "data.gz")
+		pct := percent(v, "data.gz")
+		if pct < last {
+			t.Fatalf("percent went from %v back to %v", last, pct)
+		}
+		last = pct
+		if err != nil {
+			break
+		}
+	}
+	if last != 100 {
+		t.Errorf("percent after reading everything = %v, want 100", last)
+	}
+}
+
+func TestAddGzipEstimated(t *testing.T) {
+	f := gzipFile(t, 10000)
+	if n := gzipSize(f); n != 10000 {
+		t.Fatalf("gzipSize = %d, want 10000", n)
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := newTestViz(newFakeClock())
+	r := v.AddGzipEstimated("data.gz", gz, f)
+
+	io.CopyN(io.Discard, r, 2500)
+	statusOf(v, "data.gz")
+	if p := percent(v, "data.gz"); p != 25 {
+		t.Errorf("percent = %v after 2500 of 10000 bytes, want 25", p)
+	}
+	io.Copy(io.Discard, r)
+	statusOf(v, "data.gz")
+	if p := percent(v, "data.gz"); p != 100 {
+		t.Errorf("percent = %v after reading everything, want 100", p)
+	}
+
+	// too short to hold a footer, so just counted
+	if n := gzipSize(sizedFile(t, 10)); n != 0 {
+		t.Errorf("gzipSize of a 10 byte file = %d, want 0", n)
+	}
+}
+
+// waitFor polls cond until it is true, failing the test after a second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	var buf syncBuffer
+	v := &Viz{}
+	v.Add("a", nil)
+	v.StartWriter(&buf, time.Hour)
+
+	// no panic leaves the display running
+	func() {
+		defer v.Recover()
+	}()
+	select {
+	case <-v.done:
+		t.Fatal("Recover stopped the display without a panic")
+	default:
+	}
+
+	var recovered interface{}
+	func() {
+		defer func() { recovered = recover() }()
+		defer v.Recover()
+		panic("boom")
+	}()
+	if recovered != "boom" {
+		t.Errorf("recovered %v, want the panic to continue", recovered)
+	}
+	select {
+	case <-v.done:
+	default:
+		t.Fatal("Recover did not stop the display")
+	}
+	if !strings.Contains(buf.String(), "a") {
+		t.Error("the final state was not written out")
+	}
+}
+
+func TestHeader(t *testing.T) {
+	clk := newFakeClock()
+	v := newTestViz(clk)
+	f := sizedFile(t, 1000)
+	f.Seek(500, io.SeekStart)
+	v.Add("file", f)
+	r := v.AddSized("sized", bytes.NewReader(make([]byte, 1000)), 1000)
+	io.CopyN(io.Discard, r, 250)
+	v.Add("spinner", nil)
+	v.Complete("spinner", nil)
+	clk.advance(3 * time.Second)
+
+	// the header sums the positions sampled by the previous refresh
+	draw(v, 80, 10)
+	got := row(draw(v, 80, 10), 0)
+	want := "Elapsed 0:03, 1/3 done, 750 B / 2.0 KB (37.50%), ETA --"
+	if got != want {
+		t.Errorf("header = %q, want %q", got, want)
+	}
+}
+
+func TestHeaderETA(t *testing.T) {
+	clk := newFakeClock()
+	v := newTestViz(clk)
+	v.Add("spinner", nil)
+	if h := row(draw(v, 80, 10), 0); !strings.HasSuffix(h, ", ETA --") {
+		t.Errorf("header without sized readers = %q", h)
+	}
+
+	a := v.AddSized("a", bytes.NewReader(make([]byte, 10<<10)), 10<<10)
+	b := v.AddSized("b", bytes.NewReader(make([]byte, 10<<10)), 10<<10)
+	draw(v, 80, 10)
+	clk.advance(time.Second)
+	io.CopyN(io.Discard, a, 1<<10)
+	io.CopyN(io.Discard, b, 1<<10)
+	draw(v, 80, 10)
+
+	// each rate is smoothed to 307.2 B/s, so 18 KB remain at 614.4 B/s
+	got := row(draw(v, 80, 10), 0)
+	want := "Elapsed 0:01, 0/3 done, 2.0 KB / 20.0 KB (10.00%), ETA 0:30"
+	if got != want {
+		t.Errorf("header = %q, want %q", got, want)
+	}
+}
+
+func TestHeaderDoneCount(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	for _, name := range manyNames(4) {
+		v.Add(name, nil)
+	}
+	header := func() string { return row(draw(v, 80, 10), 0) }
+	if h := header(); !strings.Contains(h, ", 0/4 done,") {
+		t.Errorf("header = %q, want 0/4 done", h)
+	}
+	v.Complete("name1", nil)
+	v.Complete("name3", errors.New("failed"))
+	if h := header(); !strings.Contains(h, ", 2/4 done,") {
+		t.Errorf("header = %q, want 2/4 done", h)
+	}
+	v.Remove("name0")
+	if h := header(); !strings.Contains(h, ", 2/3 done,") {
+		t.Errorf("header after Remove = %q, want 2/3 done", h)
+	}
+}
+
+func TestPrintSummary(t *testing.T) {
+	clk := newFakeClock()
+	v := newTestViz(clk)
+	v.Add("a.txt", nil)
+	v.Add("b.txt", nil)
+	v.Add("removed.txt", nil)
+	clk.advance(2 * time.Second)
+	v.Complete("a.txt", nil)
+	clk.advance(time.Second)
+	v.Complete("b.txt", errors.New("bad header"))
+	v.Remove("removed.txt")
+
+	var buf bytes.Buffer
+	v.PrintSummary(&buf)
+	want := "Elapsed 0:03, 2/2 done, ETA --\n" +
+		"   0:02 100.00% a.txt \n" +
+		"   0:03 100.00% b.txt bad header\n"
+	if buf.String() != want {
+		t.Errorf("summary = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestResizeEvent(t *testing.T) {
+	v := &Viz{}
+	v.redraw = make(chan struct{}, 1)
+	if !v.handleEvent(termbox.Event{Type: termbox.EventResize, Width: 100, Height: 40}) {
+		t.Fatal("polling stopped after a resize")
+	}
+	select {
+	case <-v.redraw:
+	default:
+		t.Error("resize did not request a redraw")
+	}
+	if v.handleEvent(termbox.Event{Type: termbox.EventInterrupt}) {
+		t.Error("polling continued after termbox was interrupted")
+	}
+}
+
+func TestAddFileConcurrent(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write(make([]byte, 1<<20)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	v := newTestViz(newFakeClock())
+	r := v.AddFile("data", f)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				statusOf(v, "data")
+			}
+		}
+	}()
+	n, err := io.Copy(io.Discard, r)
+	close(stop)
+	<-done
+	if err != nil || n != 1<<20 {
+		t.Fatalf("read %d bytes, %v", n, err)
+	}
+	statusOf(v, "data")
+	if p := percent(v, "data"); p != 100 {
+		t.Errorf("percent = %v after reading the whole file", p)
+	}
+}
+
+func TestStartContext(t *testing.T) {
+	var buf syncBuffer
+	v := &Viz{}
+	v.ForceMode(ModePlain)
+	v.Output(&buf)
+	v.Add("reader", nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := v.StartContext(ctx, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	select {
+	case <-v.done:
+	case <-time.After(time.Second):
+		t.Fatal("the display did not stop when the context was cancelled")
+	}
+	if !strings.Contains(buf.String(), "reader") {
+		t.Errorf("the final state was not written: %q", buf.String())
+	}
+	within(t, time.Second, "Stop", v.Stop)
+}
+
+func TestPauseResume(t *testing.T) {
+	clk := newFakeClock()
+	m := newMemRenderer(40, 6)
+	v := &Viz{render: m}
+	v.setClock(clk.now)
+	if err := v.Start(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	defer v.Stop()
+	v.Add("a", nil)
+	v.Add("b", nil)
+	v.Complete("a", nil)
+
+	v.Pause()
+	clk.advance(5 * time.Second)
+	v.Add("c", nil)
+	v.Complete("b", errors.New("failed"))
+	v.Pause() // no-op
+	if err := v.Resume(); err != nil {
+		t.Fatal(err)
+	}
+
+	st := v.Snapshot()
+	if len(st) != 3 || !st[0].Done || !st[1].Done || st[1].Err == nil || st[2].Done {
+		t.Fatalf("after resuming: %+v", st)
+	}
+	if st[1].Elapsed != 5*time.Second {
+		t.Errorf("b took %v, want 5s including the pause", st[1].Elapsed)
+	}
+	if d := v.Stats().Duration; d != 5*time.Second {
+		t.Errorf("run duration %v, want 5s including the pause", d)
+	}
+	v.Stop()
+	if got := m.String(); !strings.Contains(got, " c") {
+		t.Errorf("final frame %q does not show c", got)
+	}
+}
+
+func TestPauseAfterStop(t *testing.T) {
+	defer func(init func() error) { termboxInit = init }(termboxInit)
+	termboxInit = func() error {
+		t.Error("termbox was initialized after Stop")
+		return nil
+	}
+
+	// a terminal display which has stopped
+	v := &Viz{}
+	v.init(time.Hour)
+	v.stopped = v.now()
+
+	within(t, time.Second, "Pause after Stop", v.Pause)
+	if v.paused {
+		t.Error("Pause after Stop paused the display")
+	}
+	v.paused = true // as if paused before stopping
+	if err := v.Resume(); err != nil || !v.paused {
+		t.Errorf("Resume after Stop returned %v with paused=%v", err, v.paused)
+	}
+}
+
+func TestSetProgress(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	v.Add("records", nil)
+	tests := []struct {
+		fraction float64
+		want     string
+	}{
+		{0.1, " 10.00%"},
+		{0.4, " 40.00%"},
+		{0.995, " 99.50%"},
+		{-1, "  0.00%"},
+		{2, "100.00%"},
+	}
+	for _, tt := range tests {
+		if !v.SetProgress("records", tt.fraction) {
+			t.Fatalf("SetProgress(%v) did not find the reader", tt.fraction)
+		}
+		if got := row(draw(v, 60, 3), 1); !strings.Contains(got, tt.want+" ") {
+			t.Errorf("SetProgress(%v) drew %q, want %q", tt.fraction, got, tt.want)
+		}
+	}
+	if v.SetProgress("missing", 0.5) {
+		t.Error("SetProgress found a missing reader")
+	}
+	f := sizedFile(t, 100)
+	v.Add("file", f)
+	if v.SetProgress("file", 0.5) {
+		t.Error("SetProgress overrode a file's own progress")
+	}
+}
+
+func TestSetInterval(t *testing.T) {
+	var buf syncBuffer
+	v := &Viz{}
+	v.Add("reader", nil)
+	v.StartWriter(&buf, time.Hour)
+	defer v.Stop()
+
+	frames := func() int { return strings.Count(buf.String(), "Elapsed") }
+	time.Sleep(20 * time.Millisecond)
+	if n := frames(); n != 0 {
+		t.Fatalf("%d frames written within the first hour", n)
+	}
+	v.SetInterval(0)
+	v.SetInterval(-time.Second)
+	v.SetInterval(5 * time.Millisecond)
+	waitFor(t, "frames at the new interval", func() bool { return frames() >= 3 })
+}
+
+func TestWaitAll(t *testing.T) {
+	v := &Viz{}
+	names := manyNames(20)
+	for _, name := range names {
+		v.Add(name, nil)
+	}
+	for i, name := range names {
+		go func(i int, name string) {
+			time.Sleep(time.Duration(i%5) * time.Millisecond)
+			if i == 7 {
+				v.Remove(name)
+			} else {
+				v.Complete(name, nil)
+			}
+		}(i, name)
+	}
+	within(t, time.Second, "WaitAll", v.WaitAll)
+	for _, st := range v.Snapshot() {
+		if !st.Done {
+			t.Errorf("%s is not done after WaitAll", st.Name)
+		}
+	}
+
+	// only the readers present when WaitAll is called are waited for
+	v.Add("late", nil)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		v.WaitAll()
+	}()
+	select {
+	case <-done:
+		t.Fatal("WaitAll returned before late was completed")
+	case <-time.After(20 * time.Millisecond):
+	}
+	v.Add("later", nil)
+	v.Complete("late", nil)
+	within(t, time.Second, "WaitAll", func() { <-done })
+}
+
+func TestWaitAllEmpty(t *testing.T) {
+	within(t, time.Second, "WaitAll", (&Viz{}).WaitAll)
+}
+
+func TestAddDuringTicks(t *testing.T) {
+	v := &Viz{render: newMemRenderer(80, 20)}
+	v.Start(time.Millisecond)
+	defer v.Stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				name := fmt.Sprint("reader", i, "-", j)
+				v.Add(name, nil)
+				v.Complete(name, nil)
+				if j%2 == 0 {
+					v.Remove(name)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := len(v.Snapshot()); n != 8*25 {
+		t.Errorf("%d readers left, want %d", n, 8*25)
+	}
+}
+
+func TestAutoRemove(t *testing.T) {
+	clk := newFakeClock()
+	v := newTestViz(clk)
+	v.AutoRemove(5 * time.Second)
+	g := v.AddGroup("group")
+	g.AddChild("child", nil)
+	v.Add("done", nil)
+	v.Add("running", nil)
+	v.Complete("done", nil)
+	clk.advance(2 * time.Second)
+	v.Complete("child", nil)
+	g.Close()
+
+	expire := func() []string {
+		v.mu.Lock()
+		v.expireLocked()
+		v.mu.Unlock()
+		return readerNames(v)
+	}
+	clk.advance(4 * time.Second)
+	if got := expire(); !reflect.DeepEqual(got, []string{"group", "child", "running"}) {
+		t.Errorf("after 6s left %q, want only done removed", got)
+	}
+	clk.advance(2 * time.Second)
+	if got := expire(); !reflect.DeepEqual(got, []string{"running"}) {
+		t.Errorf("after 8s left %q, want the group removed with its child", got)
+	}
+
+	v.AutoRemove(0)
+	v.Complete("running", nil)
+	clk.advance(time.Hour)
+	if got := expire(); len(got) != 1 {
+		t.Errorf("left %q, want completed readers kept", got)
+	}
+}
+
+func TestZeroValue(t *testing.T) {
+	calls := map[string]func(v *Viz){
+		"Add":            func(v *Viz) { v.Add("a", nil) },
+		"Complete":       func(v *Viz) { v.Complete("a", nil) },
+		"Remove":         func(v *Viz) { v.Remove("a") },
+		"CompleteHandle": func(v *Viz) { v.CompleteHandle(&ReaderHandle{}, nil) },
+		"RemoveHandle":   func(v *Viz) { v.RemoveHandle(&ReaderHandle{}) },
+		"SetProgress":    func(v *Viz) { v.SetProgress("a", 0.5) },
+		"Snapshot":       func(v *Viz) { v.Snapshot() },
+		"Stats":          func(v *Viz) { v.Stats() },
+		"TotalBytes":     func(v *Viz) { v.TotalBytes() },
+		"WaitAll":        func(v *Viz) { v.WaitAll() },
+		"RenderString":   func(v *Viz) { v.RenderString() },
+		"Stop":           func(v *Viz) { v.Stop() },
+	}
+	for name, call := range calls {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("%s on a zero Viz panicked: %v", name, r)
+				}
+			}()
+			call(&Viz{})
+		}()
+	}
+
+	// readers added before Start are tracked
+	v := &Viz{}
+	if v.Complete("a", nil) {
+		t.Error("Complete found a reader in an empty Viz")
+	}
+	v.Add("a", nil)
+	if !v.Complete("a", nil) {
+		t.Error("Complete did not find the reader added before Start")
+	}
+
+	// and may be added from many goroutines at once
+	v = &Viz{}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v.Add(fmt.Sprint("reader", i), nil)
+		}(i)
+	}
+	wg.Wait()
+	if n := len(readerNames(v)); n != 8 {
+		t.Errorf("%d of 8 readers added concurrently were tracked", n)
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	clk := newFakeClock()
+	v := newTestViz(clk)
+	v.Add("a", nil)
+	v.Add("b", nil)
+	clk.advance(65 * time.Second)
+	v.Complete("a", nil)
+	clk.advance(time.Hour)
+
+	m := draw(v, 60, 3)
+	want := []string{
+		"Elapsed 1:01:05, 1/2 done, ETA --",
+		"1:01:05         b",
+		"   1:05 100.00% a",
+	}
+	for y, w := range want {
+		if got := row(m, y); got != w {
+			t.Errorf("row %d = %q, want %q", y, got, w)
+		}
+	}
+	// the next refresh spins the wheel
+	if got := statusOf(v, "b"); got != "1:01:05    -   " {
+		t.Errorf("status of b = %q", got)
+	}
+}
+
+func TestAddBuffered(t *testing.T) {
+	f := sizedFile(t, 64<<10)
+	br := bufio.NewReaderSize(f, 4096)
+	v := newTestViz(newFakeClock())
+	v.AddBuffered("data", br, f)
+
+	last := -1.0
+	buf := make([]byte, 1000)
+	for {
+		_, err := br.Read(buf)
+		statusOf(v, "data")
+		p := percent(v, "data")
+		if p < last {
+			t.Fatalf("percent fell from %v to %v", last, p)
+		}
+		last = p
+		if err == io.EOF {
+			break
+		}
+	}
+	if last != 100 {
+		t.Errorf("percent = %v after reading everything", last)
+	}
+}
+
+func TestRenderString(t *testing.T) {
+	clk := newFakeClock()
+	v := newTestViz(clk)
+	if got := v.RenderString(); got != "Elapsed 0:00, 0/0 done, ETA --\n" {
+		t.Errorf("empty display = %q", got)
+	}
+
+	v.Add("running", nil)
+	v.Add("half", nil)
+	v.SetProgress("half", 0.5)
+	v.Add("ok", nil)
+	v.Add("failed", nil)
+	clk.advance(3 * time.Second)
+	v.Complete("ok", nil)
+	v.Complete("failed", errors.New("permission denied"))
+	clk.advance(2 * time.Second)
+
+	want := `Elapsed 0:05, 2/4 done, ETA --
+0:03 100.00% failed permission denied
+0:03 100.00% ok
+0:05  50.00% half
+0:05         running
+`
+	if got := v.RenderString(); got != want {
+		t.Errorf("RenderString =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestMirrorToFile(t *testing.T) {
+	clk := newFakeClock()
+	v := newTestViz(clk)
+	path := filepath.Join(t.TempDir(), "progress.txt")
+	v.MirrorToFile(path)
+	v.Add("a", nil)
+
+	mirror := func() string {
+		v.mu.Lock()
+		v.mirrorLocked()
+		v.mu.Unlock()
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	mirror()
+	clk.advance(time.Second)
+	v.Complete("a", nil)
+	if got, want := mirror(), v.RenderString(); got != want {
+		t.Errorf("mirrored %q, want the latest frame %q", got, want)
+	}
+}
+
+// readCounter counts the times its status is read.
+type readCounter struct {
+	reads int
+}
+
+func (c *readCounter) ReadStatus() string {
+	c.reads++
+	return fmt.Sprint(c.reads)
+}
+
+func (c *readCounter) Done() {}
+
+func TestMirrorReadsOnce(t *testing.T) {
+	v := NewViz(withRenderer(newMemRenderer(40, 5)), WithInterval(time.Millisecond))
+	v.MirrorToFile(filepath.Join(t.TempDir(), "progress.txt"))
+	c := &readCounter{}
+	v.AddCustom("custom", c)
+	if err := v.Start(0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	v.Stop()
+
+	// each redraw reads it once, including those on ticks which also mirror
+	if c.reads != v.redraws {
+		t.Errorf("status read %d times in %d redraws", c.reads, v.redraws)
+	}
+}
+
+func TestMirrorToFileError(t *testing.T) {
+	v := newTestViz(newFakeClock())
+	v.quit = make(chan int) // started, so log messages are kept
+	v.MirrorToFile(filepath.Join(t.TempDir(), "missing", "progress.txt"))
+	for i := 0; i < 2; i++ {
+		v.mu.Lock()
+		v.mirrorLocked()
+		v.mu.Unlock()
+	}
+	if len(v.logs) != 1 || !strings.HasPrefix(v.logs[0], "parprog: mirroring stopped: ") {
+		t.Errorf("logged %q, want the error once", v.logs)
+	}
+}
@@ -0,0 +1,62 @@
+package parprog
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// WalkBounded calls fn on every regular file in the tree rooted at root, with
+// at most n calls in parallel. Each file is opened and added to v under its
+// path relative to root as in Add, then completed with the error fn returns.
+// As with Add, progress is shown by seeking f from the display goroutine to
+// read its offset. The file is closed once fn returns. Files (or
+// directories) which cannot be read are added and completed with the error
+// instead of stopping the walk. Other entries, such as symlinks, are skipped.
+//
+// The error returned is that of walking root itself, e.g. if it does not
+// exist. A panic in fn is handled as in BoundedExec, being re-raised once the
+// walk has finished unless OnPanic is set.
+func WalkBounded(root string, n int, v *Viz, fn func(path string, f *os.File) error) error {
+	paths := make(chan string)
+	var walkErr error
+	go func() {
+		defer close(paths)
+		walkErr = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if path == root {
+					return err
+				}
+				h := v.AddReader(walkName(root, path), nil)
+				v.CompleteHandle(h, err)
+				return nil
+			}
+			if d.Type().IsRegular() {
+				paths <- path
+			}
+			return nil
+		})
+	}()
+
+	BoundedExecChan(n, paths, func(path string) {
+		f, err := os.Open(path)
+		if err != nil {
+			h := v.AddReader(walkName(root, path), nil)
+			v.CompleteHandle(h, err)
+			return
+		}
+		defer f.Close()
+
+		h := v.AddReader(walkName(root, path), f)
+		v.completeAfter(h, path, func() error { return fn(path, f) })
+	})
+	return walkErr
+}
+
+// walkName returns the display name of path in a walk of root.
+func walkName(root, path string) string {
+	if rel, err := filepath.Rel(root, path); err == nil {
+		return rel
+	}
+	return path
+}
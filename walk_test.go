@@ -0,0 +1,140 @@
+package parprog
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// writeTree creates the given files, with their sizes, below root.
+func writeTree(t *testing.T, root string, files map[string]int) {
+	t.Helper()
+	for name, size := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWalkBounded(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]int{
+		"a.txt":         100,
+		"sub/b.txt":     2000,
+		"sub/deep/c.gz": 0,
+	})
+	// skipped by the walk, where supported
+	os.Symlink(filepath.Join(root, "a.txt"), filepath.Join(root, "link"))
+
+	v := &Viz{}
+	errBad := errors.New("bad")
+	err := WalkBounded(root, 2, v, func(path string, f *os.File) error {
+		if info, err := f.Stat(); err != nil || info.Name() != filepath.Base(path) {
+			t.Errorf("%s: Stat returned %v, %v", path, info, err)
+		}
+		if _, err := io.Copy(io.Discard, f); err != nil {
+			return err
+		}
+		if filepath.Base(path) == "b.txt" {
+			return errBad
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, st := range v.Snapshot() {
+		names = append(names, st.Name)
+		if !st.Done || st.Percent != 100 {
+			t.Errorf("%s: done %v at %v%%", st.Name, st.Done, st.Percent)
+		}
+		wantErr := error(nil)
+		if st.Name == filepath.Join("sub", "b.txt") {
+			wantErr = errBad
+		}
+		if st.Err != wantErr {
+			t.Errorf("%s completed with %v, want %v", st.Name, st.Err, wantErr)
+		}
+	}
+	sort.Strings(names)
+	want := []string{"a.txt", filepath.Join("sub", "b.txt"), filepath.Join("sub", "deep", "c.gz")}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("walked %q, want %q", names, want)
+	}
+	if n := v.TotalBytes(); n != 2100 {
+		t.Errorf("counted %d bytes, want 2100", n)
+	}
+}
+
+func TestWalkBoundedProgress(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]int{"data": 1000})
+
+	v := &Viz{}
+	WalkBounded(root, 1, v, func(path string, f *os.File) error {
+		if _, err := io.CopyN(io.Discard, f, 250); err != nil {
+			return err
+		}
+		statusOf(v, "data")
+		if p := percent(v, "data"); p != 25 {
+			t.Errorf("percent = %v after reading 250 of 1000 bytes, want 25", p)
+		}
+		return nil
+	})
+}
+
+func TestWalkBoundedUnreadable(t *testing.T) {
+	if os.Getuid() == 0 {
+		t.Skip("root can read anything")
+	}
+	root := t.TempDir()
+	writeTree(t, root, map[string]int{"ok.txt": 10, "locked/x.txt": 10, "secret.txt": 10})
+	if err := os.Chmod(filepath.Join(root, "locked"), 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(filepath.Join(root, "locked"), 0755)
+	if err := os.Chmod(filepath.Join(root, "secret.txt"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	v := &Viz{}
+	err := WalkBounded(root, 2, v, func(path string, f *os.File) error {
+		_, err := io.Copy(io.Discard, f)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"locked", "secret.txt"} {
+		if err, found := v.Error(name); !found || !errors.Is(err, os.ErrPermission) {
+			t.Errorf("%s completed with %v, want a permission error", name, err)
+		}
+	}
+	if err, found := v.Error("ok.txt"); !found || err != nil {
+		t.Errorf("ok.txt completed with %v", err)
+	}
+}
+
+func TestWalkBoundedMissingRoot(t *testing.T) {
+	v := &Viz{}
+	err := WalkBounded(filepath.Join(t.TempDir(), "missing"), 2, v, func(string, *os.File) error {
+		t.Error("fn called for a missing root")
+		return nil
+	})
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("returned %v, want a not-exist error", err)
+	}
+	if st := v.Snapshot(); len(st) != 0 {
+		t.Errorf("added %+v", st)
+	}
+}